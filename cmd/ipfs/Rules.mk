@@ -13,7 +13,11 @@ PATH := $(realpath $(d)):$(PATH)
 # DEPS_OO_$(d) += merkledag/pb/merkledag.pb.go namesys/pb/namesys.pb.go
 # DEPS_OO_$(d) += pin/internal/pb/header.pb.go unixfs/pb/unixfs.pb.go
 
-$(d)_flags =-ldflags="-X "github.com/ipfs/kubo".CurrentCommit=$(git-hash)"
+# use the commit time rather than the current time to keep builds reproducible
+build-epoch:=$(or $(SOURCE_DATE_EPOCH),$(shell git log -1 --format=%ct 2>/dev/null))
+build-date:=$(shell date -u -d @$(build-epoch) +%Y-%m-%dT%H:%M:%SZ 2>/dev/null || date -u -r $(build-epoch) +%Y-%m-%dT%H:%M:%SZ 2>/dev/null)
+
+$(d)_flags =-ldflags="-X "github.com/ipfs/kubo".CurrentCommit=$(git-hash) -X "github.com/ipfs/kubo".CurrentBuildDate=$(build-date)"
 
 $(d)-try-build $(IPFS_BIN_$(d)): GOFLAGS += $(cmd/ipfs_flags)
 
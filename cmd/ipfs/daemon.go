@@ -370,6 +370,12 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	if err != nil {
 		return err
 	}
+	if err := cfg.Datastore.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Metrics.Validate(); err != nil {
+		return err
+	}
 
 	if !psSet {
 		pubsub = cfg.Pubsub.Enabled.WithDefault(false)
@@ -553,21 +559,65 @@ take effect.
 	var ipfsInfoMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "ipfs_info",
 		Help: "IPFS version information.",
-	}, []string{"version", "commit"})
+	}, []string{"version", "commit", "build_date"})
 
 	// Setting to 1 lets us multiply it with other stats to add the version labels
 	ipfsInfoMetric.With(prometheus.Labels{
-		"version": version.CurrentVersionNumber,
-		"commit":  version.CurrentCommit,
+		"version":    version.CurrentVersionNumber,
+		"commit":     orUnknown(version.CurrentCommit),
+		"build_date": orUnknown(version.CurrentBuildDate),
 	}).Set(1)
 
+	// Expose the effective routing mode, after --routing and the private
+	// network fallback have been applied. An offline node doesn't route at
+	// all, whatever the configured mode.
+	var routingModeMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_routing_mode",
+		Help: "Routing mode the daemon is running with.",
+	}, []string{"mode"})
+	routingMode := routingOption
+	if !node.IsOnline {
+		routingMode = offlineKwd
+	}
+	routingModeMetric.With(prometheus.Labels{"mode": routingMode}).Set(1)
+
 	// TODO(9285): make metrics more configurable
 	// initialize metrics collector
-	prometheus.MustRegister(&corehttp.IpfsNodeCollector{Node: node})
+	prometheus.MustRegister(&corehttp.IpfsNodeCollector{
+		Node:             node,
+		PeersByAgentTopN: int(cfg.Metrics.PeersByAgentTopN.WithDefault(config.DefaultMetricsPeersByAgentTopN)),
+	})
+	prometheus.MustRegister(&corehttp.BootstrapHealthCollector{Node: node})
+	dhtCollector := &corehttp.DHTCollector{Node: node}
+	prometheus.MustRegister(dhtCollector)
+	go dhtCollector.RefreshProviderRecords(node.Context())
+	pinCollector := &corehttp.PinCollector{
+		Node:            node,
+		IncludeIndirect: cfg.Metrics.PinMetricsIncludeIndirect.WithDefault(false),
+	}
+	prometheus.MustRegister(pinCollector)
+	go pinCollector.RefreshPins(node.Context())
+	prometheus.MustRegister(&corehttp.WantlistCollector{Node: node})
+	if topN := cfg.Metrics.BandwidthByPeerTopN.WithDefault(0); topN > 0 {
+		prometheus.MustRegister(corehttp.BandwidthByPeerCollector{Node: node, TopN: int(topN)})
+	}
+
+	// push metrics to a pushgateway, if configured
+	if url := cfg.Metrics.PrometheusPushgateway.WithDefault(""); url != "" {
+		interval := cfg.Metrics.PrometheusPushInterval.WithDefault(config.DefaultMetricsPushInterval)
+		go corehttp.PushMetrics(req.Context, prometheus.DefaultGatherer, url, interval, node.Identity)
+	}
 
 	// start MFS pinning thread
 	startPinMFS(daemonConfigPollInterval, cctx, &ipfsPinMFSNode{node})
 
+	// start the blockstore integrity check, if enabled
+	go func() {
+		if err := corerepo.PeriodicIntegrityCheck(req.Context, node); err != nil {
+			log.Errorf("failed to start blockstore integrity check: %s", err)
+		}
+	}()
+
 	// The daemon is *finally* ready.
 	fmt.Printf("Daemon is ready\n")
 	notifyReady()
@@ -965,6 +1015,15 @@ func merge(cs ...<-chan error) <-chan error {
 	return out
 }
 
+// orUnknown returns s, or "unknown" for build variables that were not set
+// through ldflags.
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
 func YesNoPrompt(prompt string) bool {
 	var s string
 	for i := 0; i < 3; i++ {
@@ -30,6 +30,7 @@ type Config struct {
 	Peering   Peering
 	DNS       DNS
 	Migration Migration
+	Metrics   Metrics
 
 	Provider     Provider
 	Reprovider   Reprovider
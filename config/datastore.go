@@ -2,11 +2,18 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // DefaultDataStoreDirectory is the directory to store all the local IPFS data.
 const DefaultDataStoreDirectory = "datastore"
 
+const (
+	// DefaultIntegrityCheckInterval of zero disables the periodic integrity check.
+	DefaultIntegrityCheckInterval   = 0
+	DefaultIntegrityCheckSampleSize = 16
+)
+
 // Datastore tracks the configuration of the datastore.
 type Datastore struct {
 	StorageMax         string // in B, kB, kiB, MB, ...
@@ -23,6 +30,17 @@ type Datastore struct {
 
 	HashOnRead      bool
 	BloomFilterSize int
+
+	IntegrityCheckInterval   *OptionalDuration `json:",omitempty"` // How often to verify a sample of stored blocks
+	IntegrityCheckSampleSize *OptionalInteger  `json:",omitempty"` // How many blocks to verify on each check
+}
+
+// Validate returns an error describing the first invalid option, if any.
+func (d *Datastore) Validate() error {
+	if size := d.IntegrityCheckSampleSize.WithDefault(DefaultIntegrityCheckSampleSize); size < 1 {
+		return fmt.Errorf("Datastore.IntegrityCheckSampleSize: must be positive, got %d", size)
+	}
+	return nil
 }
 
 // DataStorePath returns the default data store path given a configuration root
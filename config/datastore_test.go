@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDatastoreValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		datastore Datastore
+		valid     bool
+	}{
+		{"defaults", Datastore{}, true},
+		{"sample size", Datastore{IntegrityCheckSampleSize: NewOptionalInteger(1)}, true},
+		{"zero sample size", Datastore{IntegrityCheckSampleSize: NewOptionalInteger(0)}, false},
+		{"negative sample size", Datastore{IntegrityCheckSampleSize: NewOptionalInteger(-1)}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.datastore.Validate()
+			if tc.valid && err != nil {
+				t.Fatalf("expected a valid config, got %s", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
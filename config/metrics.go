@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultMetricsPushInterval is how often metrics are pushed to a
+	// pushgateway by default.
+	DefaultMetricsPushInterval = time.Minute
+	// DefaultMetricsPeersByAgentTopN is the number of agent versions
+	// connected peers are broken down by, by default.
+	DefaultMetricsPeersByAgentTopN = 20
+)
+
+// Metrics configures how the node's Prometheus metrics are exported, in
+// addition to being served by the API at /debug/metrics/prometheus.
+type Metrics struct {
+	// PrometheusPushgateway is the URL of a Prometheus pushgateway the
+	// metrics are pushed to, for nodes that can't be scraped. Pushing is
+	// disabled when unset.
+	PrometheusPushgateway *OptionalString `json:",omitempty"`
+	// PrometheusPushInterval is how often the metrics are pushed.
+	PrometheusPushInterval *OptionalDuration `json:",omitempty"`
+	// BandwidthByPeerTopN is the number of peers, with the highest
+	// throughput, whose bandwidth is reported. Zero disables the report.
+	BandwidthByPeerTopN *OptionalInteger `json:",omitempty"`
+	// PeersByAgentTopN is the number of most common agent versions the
+	// connected peers are broken down by, the others are counted together.
+	// Zero disables the breakdown.
+	PeersByAgentTopN *OptionalInteger `json:",omitempty"`
+	// PinMetricsIncludeIndirect makes ipfs_pins count indirect pins too,
+	// which means walking every recursively pinned DAG on each count.
+	PinMetricsIncludeIndirect Flag `json:",omitempty"`
+}
+
+// Validate returns an error describing the first invalid option, if any.
+func (m *Metrics) Validate() error {
+	if gw := m.PrometheusPushgateway.WithDefault(""); gw != "" {
+		u, err := url.Parse(gw)
+		if err != nil {
+			return fmt.Errorf("Metrics.PrometheusPushgateway: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("Metrics.PrometheusPushgateway: %q is not an http(s) URL", gw)
+		}
+	}
+	if interval := m.PrometheusPushInterval.WithDefault(DefaultMetricsPushInterval); interval <= 0 {
+		return fmt.Errorf("Metrics.PrometheusPushInterval: must be positive, got %s", interval)
+	}
+	if topN := m.BandwidthByPeerTopN.WithDefault(0); topN < 0 {
+		return fmt.Errorf("Metrics.BandwidthByPeerTopN: must not be negative, got %d", topN)
+	}
+	if topN := m.PeersByAgentTopN.WithDefault(DefaultMetricsPeersByAgentTopN); topN < 0 {
+		return fmt.Errorf("Metrics.PeersByAgentTopN: must not be negative, got %d", topN)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		metrics Metrics
+		valid   bool
+	}{
+		{"defaults", Metrics{}, true},
+		{"pushgateway", Metrics{PrometheusPushgateway: NewOptionalString("http://localhost:9091")}, true},
+		{"malformed pushgateway", Metrics{PrometheusPushgateway: NewOptionalString("http://[::1")}, false},
+		{"pushgateway without scheme", Metrics{PrometheusPushgateway: NewOptionalString("localhost:9091")}, false},
+		{"zero push interval", Metrics{PrometheusPushInterval: NewOptionalDuration(0)}, false},
+		{"negative push interval", Metrics{PrometheusPushInterval: NewOptionalDuration(-time.Second)}, false},
+		{"negative top N", Metrics{BandwidthByPeerTopN: NewOptionalInteger(-1)}, false},
+		{"no agents", Metrics{PeersByAgentTopN: NewOptionalInteger(0)}, true},
+		{"negative agents top N", Metrics{PeersByAgentTopN: NewOptionalInteger(-1)}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.metrics.Validate()
+			if tc.valid && err != nil {
+				t.Fatalf("expected a valid config, got %s", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -255,6 +255,7 @@ func (api *CoreAPI) getSession(ctx context.Context) *CoreAPI {
 
 	// TODO: We could also apply this to api.blocks, and compose into writable api,
 	// but this requires some changes in blockservice/merkledag
+	trackSession(ctx)
 	sesAPI.dag = dag.NewReadOnlyDagService(dag.NewSession(ctx, api.dag))
 
 	return &sesAPI
@@ -2,16 +2,63 @@ package coreapi
 
 import (
 	"context"
+	"sync"
 
 	cid "github.com/ipfs/go-cid"
 	pin "github.com/ipfs/go-ipfs-pinner"
 	ipld "github.com/ipfs/go-ipld-format"
 	dag "github.com/ipfs/go-merkledag"
 	"github.com/ipfs/kubo/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var activeDagSessions = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: "ipfs",
+	Subsystem: "dag",
+	Name:      "active_sessions",
+	Help:      "Number of DAG sessions currently open.",
+}, func() float64 {
+	dagSessions.Lock()
+	defer dagSessions.Unlock()
+	dagSessions.prune()
+	return float64(len(dagSessions.ctxs))
+})
+
+// dagSessions holds the contexts of the open DAG sessions. A session is open
+// until its context is done, which is also when the underlying exchange
+// session is torn down. Done contexts are dropped when sessions are counted
+// or added, so no goroutine has to wait on each of them.
+var dagSessions sessionSet
+
+type sessionSet struct {
+	sync.Mutex
+	ctxs []context.Context
+}
+
+func (s *sessionSet) prune() {
+	open := s.ctxs[:0]
+	for _, ctx := range s.ctxs {
+		if ctx.Err() == nil {
+			open = append(open, ctx)
+		}
+	}
+	for i := len(open); i < len(s.ctxs); i++ {
+		s.ctxs[i] = nil
+	}
+	s.ctxs = open
+}
+
+// trackSession counts a DAG session as open until its context is done.
+func trackSession(ctx context.Context) {
+	dagSessions.Lock()
+	defer dagSessions.Unlock()
+	dagSessions.prune()
+	dagSessions.ctxs = append(dagSessions.ctxs, ctx)
+}
+
 type dagAPI struct {
 	ipld.DAGService
 
@@ -60,6 +107,7 @@ func (api *dagAPI) Pinning() ipld.NodeAdder {
 }
 
 func (api *dagAPI) Session(ctx context.Context) ipld.NodeGetter {
+	trackSession(ctx)
 	return dag.NewSession(ctx, api.DAGService)
 }
 
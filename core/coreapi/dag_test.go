@@ -0,0 +1,29 @@
+package coreapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveDagSessions(t *testing.T) {
+	base := testutil.ToFloat64(activeDagSessions)
+	active := func() float64 { return testutil.ToFloat64(activeDagSessions) - base }
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	trackSession(ctx1)
+	trackSession(ctx2)
+	require.Equal(t, 2.0, active())
+
+	cancel1()
+	require.Equal(t, 1.0, active())
+
+	cancel2()
+	require.Equal(t, 0.0, active())
+}
@@ -1,17 +1,39 @@
 package corehttp
 
 import (
+	"context"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dsq "github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	bitswap "github.com/ipfs/go-libipfs/bitswap"
+	"github.com/ipfs/go-merkledag"
 	core "github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/node/libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	circuitproto "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	ma "github.com/multiformats/go-multiaddr"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/zpages"
 
 	ocprom "contrib.go.opencensus.io/exporter/prometheus"
 	prometheus "github.com/prometheus/client_golang/prometheus"
 	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 // MetricsScrapingOption adds the scraping endpoint which Prometheus uses to fetch metrics.
@@ -158,14 +180,116 @@ var (
 		[]string{"transport"},
 		nil,
 	)
+	protectedPeersMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "connmgr", "protected_peers"),
+		"Number of connected peers protected from connection trimming",
+		nil,
+		nil,
+	)
+	advertisedAddrsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "network", "advertised_addrs"),
+		"Number of addresses advertised by the node",
+		nil,
+		nil,
+	)
+	filteredAddrsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "network", "filtered_addrs"),
+		"Number of advertised addresses matched by Swarm.AddrFilters",
+		nil,
+		nil,
+	)
+	peersLatencyMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "peers", "latency_seconds"),
+		"Distribution of the latency to connected peers",
+		nil,
+		nil,
+	)
+	peersByAgentMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "peers", "by_agent"),
+		"Number of connected peers by agent version",
+		[]string{"agent"},
+		nil,
+	)
+	transientConnsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "network", "transient_connections"),
+		"Number of open connections with a limited (transient) resource budget",
+		nil,
+		nil,
+	)
+	rcmgrSystemUsedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "rcmgr", "system_used"),
+		"Resources in use at the resource manager system scope",
+		[]string{"resource"},
+		nil,
+	)
+	rcmgrSystemLimitMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "rcmgr", "system_limit"),
+		"Limit of the resource manager system scope",
+		[]string{"resource"},
+		nil,
+	)
+	protocolHandlersMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "network", "protocol_handlers"),
+		"Number of stream protocol handlers registered on the host",
+		nil,
+		nil,
+	)
+	bitswapBroadcastFanoutMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bitswap", "broadcast_fanout"),
+		"Number of peers a bitswap want broadcast is sent to",
+		nil,
+		nil,
+	)
+	relayReservationsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "relay", "reservations"),
+		"Number of relays we hold a reservation with, as advertised in our addresses",
+		nil,
+		nil,
+	)
+	relayCircuitsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "relay", "service_circuits"),
+		"Number of connections our relay service is currently relaying",
+		nil,
+		nil,
+	)
+	pubsubTopicsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "pubsub", "topics"),
+		"Number of pubsub topics we are subscribed to",
+		nil,
+		nil,
+	)
+	pubsubTopicPeersMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "pubsub", "topic_peers"),
+		"Number of peers we know are subscribed to each of our pubsub topics",
+		[]string{"topic"},
+		nil,
+	)
 )
 
 type IpfsNodeCollector struct {
 	Node *core.IpfsNode
+	// PeersByAgentTopN is the number of agent versions reported by
+	// libp2p_peers_by_agent, the others are reported as "other". Zero
+	// disables the metric.
+	PeersByAgentTopN int
 }
 
 func (IpfsNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- peersTotalMetric
+	ch <- protectedPeersMetric
+	ch <- advertisedAddrsMetric
+	ch <- filteredAddrsMetric
+	ch <- peersLatencyMetric
+	ch <- peersByAgentMetric
+	ch <- transientConnsMetric
+	ch <- rcmgrSystemUsedMetric
+	ch <- rcmgrSystemLimitMetric
+	ch <- protocolHandlersMetric
+	ch <- bitswapBroadcastFanoutMetric
+	ch <- relayReservationsMetric
+	ch <- relayCircuitsMetric
+	ch <- pubsubTopicsMetric
+	ch <- pubsubTopicPeersMetric
 }
 
 func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -177,6 +301,96 @@ func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
 			tr,
 		)
 	}
+	ch <- prometheus.MustNewConstMetric(
+		protectedPeersMetric,
+		prometheus.GaugeValue,
+		c.ProtectedPeersValue(),
+	)
+	advertised, filtered := c.AddrsValues()
+	ch <- prometheus.MustNewConstMetric(
+		advertisedAddrsMetric,
+		prometheus.GaugeValue,
+		advertised,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		filteredAddrsMetric,
+		prometheus.GaugeValue,
+		filtered,
+	)
+	count, sum, buckets := c.PeersLatencyValues()
+	ch <- prometheus.MustNewConstHistogram(
+		peersLatencyMetric,
+		count,
+		sum,
+		buckets,
+	)
+	if c.PeersByAgentTopN > 0 {
+		for agent, val := range c.PeersByAgentValues(c.PeersByAgentTopN) {
+			ch <- prometheus.MustNewConstMetric(
+				peersByAgentMetric,
+				prometheus.GaugeValue,
+				val,
+				agent,
+			)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		transientConnsMetric,
+		prometheus.GaugeValue,
+		c.TransientConnsValue(),
+	)
+	used, limit := c.RcmgrSystemValues()
+	for resource, val := range used {
+		ch <- prometheus.MustNewConstMetric(
+			rcmgrSystemUsedMetric,
+			prometheus.GaugeValue,
+			val,
+			resource,
+		)
+	}
+	for resource, val := range limit {
+		ch <- prometheus.MustNewConstMetric(
+			rcmgrSystemLimitMetric,
+			prometheus.GaugeValue,
+			val,
+			resource,
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		protocolHandlersMetric,
+		prometheus.GaugeValue,
+		c.ProtocolHandlersValue(),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		bitswapBroadcastFanoutMetric,
+		prometheus.GaugeValue,
+		c.BroadcastFanoutValue(),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		relayReservationsMetric,
+		prometheus.GaugeValue,
+		c.RelayReservationsValue(),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		relayCircuitsMetric,
+		prometheus.GaugeValue,
+		c.RelayCircuitsValue(),
+	)
+	if topics := c.PubsubTopicPeersValues(); topics != nil {
+		ch <- prometheus.MustNewConstMetric(
+			pubsubTopicsMetric,
+			prometheus.GaugeValue,
+			float64(len(topics)),
+		)
+		for topic, val := range topics {
+			ch <- prometheus.MustNewConstMetric(
+				pubsubTopicPeersMetric,
+				prometheus.GaugeValue,
+				val,
+				topic,
+			)
+		}
+	}
 }
 
 func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
@@ -202,3 +416,811 @@ func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
 	}
 	return vals
 }
+
+func (c IpfsNodeCollector) ProtectedPeersValue() float64 {
+	if c.Node.PeerHost == nil {
+		return 0
+	}
+	cm := c.Node.PeerHost.ConnManager()
+	var protected float64
+	for _, peerID := range c.Node.PeerHost.Network().Peers() {
+		// An empty tag matches a peer protected under any tag.
+		if cm.IsProtected(peerID, "") {
+			protected++
+		}
+	}
+	return protected
+}
+
+// AddrsValues returns the number of addresses advertised by the node and how
+// many of those fall in the ranges of Swarm.AddrFilters. The filters are
+// only checked against remote addresses, when dialing and accepting, so the
+// node keeps advertising these; a non-zero filtered count means it announces
+// addresses that peers sharing its filters, e.g. other nodes using the server
+// profile, won't dial.
+func (c IpfsNodeCollector) AddrsValues() (advertised float64, filtered float64) {
+	if c.Node.PeerHost == nil {
+		return 0, 0
+	}
+	for _, addr := range c.Node.PeerHost.Addrs() {
+		advertised++
+		if c.Node.Filters != nil && c.Node.Filters.AddrBlocked(addr) {
+			filtered++
+		}
+	}
+	return advertised, filtered
+}
+
+// peersLatencyBuckets are the upper bounds, in seconds, of the peer latency
+// histogram buckets.
+var peersLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// PeersLatencyValues samples the latency of every connected peer and returns
+// its distribution, as expected by prometheus.NewConstHistogram. Peers whose
+// latency wasn't measured yet are left out.
+func (c IpfsNodeCollector) PeersLatencyValues() (count uint64, sum float64, buckets map[float64]uint64) {
+	buckets = make(map[float64]uint64, len(peersLatencyBuckets))
+	for _, b := range peersLatencyBuckets {
+		buckets[b] = 0
+	}
+	if c.Node.PeerHost == nil {
+		return 0, 0, buckets
+	}
+
+	ps := c.Node.PeerHost.Peerstore()
+	for _, p := range c.Node.PeerHost.Network().Peers() {
+		latency := ps.LatencyEWMA(p).Seconds()
+		if latency <= 0 {
+			continue
+		}
+		count++
+		sum += latency
+		for _, b := range peersLatencyBuckets {
+			if latency <= b {
+				buckets[b]++
+			}
+		}
+	}
+	return count, sum, buckets
+}
+
+// PeersByAgentValues counts the connected peers by the agent version they
+// announced over identify. Peers that weren't identified yet are counted as
+// "unknown", and all but the topN most common agents as "other". Agents are
+// set by remote peers, so they go through labelValue.
+func (c IpfsNodeCollector) PeersByAgentValues(topN int) map[string]float64 {
+	vals := make(map[string]float64)
+	if c.Node.PeerHost == nil {
+		return vals
+	}
+
+	counts := make(map[string]float64)
+	for _, p := range c.Node.PeerHost.Network().Peers() {
+		agent := "unknown"
+		if v, err := c.Node.PeerHost.Peerstore().Get(p, "AgentVersion"); err == nil {
+			if s, ok := v.(string); ok && s != "" {
+				agent = labelValue(s)
+			}
+		}
+		counts[agent]++
+	}
+
+	agents := make([]string, 0, len(counts))
+	for agent := range counts {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		if counts[agents[i]] != counts[agents[j]] {
+			return counts[agents[i]] > counts[agents[j]]
+		}
+		return agents[i] < agents[j]
+	})
+	for i, agent := range agents {
+		if i < topN {
+			vals[agent] += counts[agent]
+		} else {
+			vals["other"] += counts[agent]
+		}
+	}
+	return vals
+}
+
+// maxLabelValueLen bounds the length, in bytes, of label values taken from
+// untrusted input.
+const maxLabelValueLen = 128
+
+// labelValue turns an arbitrary string, e.g. sent by a remote peer, into a
+// valid label value: invalid UTF-8 makes the collector panic, so it is
+// replaced, and the value is truncated to maxLabelValueLen bytes.
+func labelValue(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) > maxLabelValueLen {
+		i := maxLabelValueLen
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		s = s[:i]
+	}
+	return s
+}
+
+// TransientConnsValue returns the number of open connections that are
+// transient, such as connections through a limited relay.
+func (c IpfsNodeCollector) TransientConnsValue() float64 {
+	if c.Node.PeerHost == nil {
+		return 0
+	}
+	var transient float64
+	for _, conn := range c.Node.PeerHost.Network().Conns() {
+		if conn.Stat().Transient {
+			transient++
+		}
+	}
+	return transient
+}
+
+// RcmgrSystemValues returns the connections, streams and memory in use at the
+// system scope of the resource manager, and their limits. Both are empty when
+// the resource manager is disabled.
+func (c IpfsNodeCollector) RcmgrSystemValues() (used map[string]float64, limit map[string]float64) {
+	used = make(map[string]float64)
+	limit = make(map[string]float64)
+	if c.Node.PeerHost == nil {
+		return used, limit
+	}
+	_ = c.Node.PeerHost.Network().ResourceManager().ViewSystem(func(s network.ResourceScope) error {
+		limiter, ok := s.(rcmgr.ResourceScopeLimiter)
+		if !ok { // NullResourceManager
+			return nil
+		}
+		stat := s.Stat()
+		used["conns"] = float64(stat.NumConnsInbound + stat.NumConnsOutbound)
+		used["streams"] = float64(stat.NumStreamsInbound + stat.NumStreamsOutbound)
+		used["memory"] = float64(stat.Memory)
+
+		l := limiter.Limit()
+		limit["conns"] = float64(l.GetConnTotalLimit())
+		limit["streams"] = float64(l.GetStreamTotalLimit())
+		limit["memory"] = float64(l.GetMemoryLimit())
+		return nil
+	})
+	return used, limit
+}
+
+func (c IpfsNodeCollector) ProtocolHandlersValue() float64 {
+	if c.Node.PeerHost == nil {
+		return 0
+	}
+	return float64(len(c.Node.PeerHost.Mux().Protocols()))
+}
+
+// bitswapStater is the part of the bitswap exchange the collector reads.
+type bitswapStater interface {
+	Stat() (*bitswap.Stat, error)
+}
+
+// BroadcastFanoutValue returns the number of peers a want broadcast reaches.
+// Bitswap broadcasts want-haves to every peer it has a ledger with, which are
+// the peers reported by its stats.
+func (c IpfsNodeCollector) BroadcastFanoutValue() float64 {
+	bs, ok := c.Node.Exchange.(bitswapStater)
+	if !ok {
+		return 0
+	}
+	stat, err := bs.Stat()
+	if err != nil {
+		return 0
+	}
+	return float64(len(stat.Peers))
+}
+
+// RelayReservationsValue returns the number of distinct relays found in our
+// relayed addresses. Autorelay advertises such an address for each relay it
+// holds a reservation with.
+func (c IpfsNodeCollector) RelayReservationsValue() float64 {
+	if c.Node.PeerHost == nil {
+		return 0
+	}
+	relays := make(map[string]struct{})
+	for _, addr := range c.Node.PeerHost.Addrs() {
+		relay, circuit := ma.SplitFunc(addr, func(c ma.Component) bool {
+			return c.Protocol().Code == ma.P_CIRCUIT
+		})
+		if circuit == nil {
+			continue
+		}
+		if id, err := relay.ValueForProtocol(ma.P_P2P); err == nil {
+			relays[id] = struct{}{}
+		}
+	}
+	return float64(len(relays))
+}
+
+// RelayCircuitsValue returns the number of circuits our relay service is
+// relaying. The relay keeps a STOP stream open to the destination of each
+// circuit for as long as it lasts, so these are the outbound STOP streams.
+func (c IpfsNodeCollector) RelayCircuitsValue() float64 {
+	if c.Node.PeerHost == nil {
+		return 0
+	}
+	var circuits float64
+	for _, conn := range c.Node.PeerHost.Network().Conns() {
+		for _, s := range conn.GetStreams() {
+			if s.Protocol() == circuitproto.ProtoIDv2Stop && s.Stat().Direction == network.DirOutbound {
+				circuits++
+			}
+		}
+	}
+	return circuits
+}
+
+// PubsubTopicPeersValues returns the number of peers subscribed to each of
+// the topics we are subscribed to, or nil when pubsub is not enabled. Only
+// our own topics are reported to keep the number of series bounded. Topics
+// are keyed by their label value, see libp2p.PubsubTopicLabel.
+func (c IpfsNodeCollector) PubsubTopicPeersValues() map[string]float64 {
+	if c.Node.PubSub == nil {
+		return nil
+	}
+	vals := make(map[string]float64)
+	for _, topic := range c.Node.PubSub.GetTopics() {
+		vals[libp2p.PubsubTopicLabel(topic)] = float64(len(c.Node.PubSub.ListPeers(topic)))
+	}
+	return vals
+}
+
+var (
+	bootstrapPeerConnectedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bootstrap", "peer_connected"),
+		"Whether the node is connected to a configured bootstrap peer",
+		[]string{"peer"},
+		nil,
+	)
+	bootstrapPeerLatencyMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bootstrap", "peer_latency_seconds"),
+		"Latency to a configured bootstrap peer",
+		[]string{"peer"},
+		nil,
+	)
+	bootstrapPeerLastSeenMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bootstrap", "peer_last_seen_timestamp_seconds"),
+		"Last time the node was seen connected to a configured bootstrap peer",
+		[]string{"peer"},
+		nil,
+	)
+)
+
+// BootstrapPeerHealth describes the connectivity of the node to one of the
+// bootstrap peers listed in its config.
+type BootstrapPeerHealth struct {
+	Peer      peer.ID
+	Connected bool
+	Latency   time.Duration
+	// LastSeen is the last time the peer was observed as connected, it is
+	// zero if it never was.
+	LastSeen time.Time
+}
+
+// BootstrapHealthCollector cross-references the configured bootstrap peers
+// with the state of the network, remembering when each of them was last seen
+// connected.
+type BootstrapHealthCollector struct {
+	Node *core.IpfsNode
+
+	mu       sync.Mutex
+	lastSeen map[peer.ID]time.Time
+}
+
+func (*BootstrapHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bootstrapPeerConnectedMetric
+	ch <- bootstrapPeerLatencyMetric
+	ch <- bootstrapPeerLastSeenMetric
+}
+
+func (c *BootstrapHealthCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, h := range c.BootstrapHealthValues() {
+		pid := h.Peer.String()
+		connected := 0.0
+		if h.Connected {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(bootstrapPeerConnectedMetric, prometheus.GaugeValue, connected, pid)
+		if h.Latency > 0 {
+			ch <- prometheus.MustNewConstMetric(bootstrapPeerLatencyMetric, prometheus.GaugeValue, h.Latency.Seconds(), pid)
+		}
+		if !h.LastSeen.IsZero() {
+			ch <- prometheus.MustNewConstMetric(bootstrapPeerLastSeenMetric, prometheus.GaugeValue, float64(h.LastSeen.Unix()), pid)
+		}
+	}
+}
+
+func (c *BootstrapHealthCollector) BootstrapHealthValues() []BootstrapPeerHealth {
+	if c.Node.PeerHost == nil || c.Node.Repo == nil {
+		return nil
+	}
+	cfg, err := c.Node.Repo.Config()
+	if err != nil {
+		return nil
+	}
+	bootstrappers, err := cfg.BootstrapPeers()
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastSeen == nil {
+		c.lastSeen = make(map[peer.ID]time.Time)
+	}
+
+	now := time.Now()
+	vals := make([]BootstrapPeerHealth, 0, len(bootstrappers))
+	for _, pi := range bootstrappers {
+		h := BootstrapPeerHealth{
+			Peer:      pi.ID,
+			Connected: c.Node.PeerHost.Network().Connectedness(pi.ID) == network.Connected,
+			Latency:   c.Node.PeerHost.Peerstore().LatencyEWMA(pi.ID),
+		}
+		if h.Connected {
+			c.lastSeen[pi.ID] = now
+		}
+		h.LastSeen = c.lastSeen[pi.ID]
+		vals = append(vals, h)
+	}
+	return vals
+}
+
+var (
+	dhtRoutingTableSizeMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "routing_table_size"),
+		"Number of peers in the DHT routing table",
+		[]string{"dht"},
+		nil,
+	)
+	dhtRoutingTableAddedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "routing_table_peers_added_total"),
+		"Number of peers seen joining the DHT routing table between collections",
+		[]string{"dht"},
+		nil,
+	)
+	dhtRoutingTableRemovedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "routing_table_peers_removed_total"),
+		"Number of peers seen leaving the DHT routing table between collections",
+		[]string{"dht"},
+		nil,
+	)
+	dhtProviderRecordsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "provider_records"),
+		"Number of provider records held in the local datastore, recounted every 5 minutes",
+		nil,
+		nil,
+	)
+)
+
+// providerRecordsScanInterval is how often RefreshProviderRecords scans the
+// providers datastore.
+const providerRecordsScanInterval = 5 * time.Minute
+
+// DHTRoutingTableStats describes the routing table of one of the WAN and LAN
+// DHTs. Added and Removed accumulate the changes seen between collections, so
+// a peer that joins and leaves in between two of them is not counted.
+type DHTRoutingTableStats struct {
+	DHT     string
+	Size    int
+	Added   uint64
+	Removed uint64
+}
+
+// DHTCollector reports the size of the node's DHT routing tables and how
+// much they churn. It reports nothing when the node doesn't run the dual DHT,
+// e.g. when it is offline or uses a custom router.
+type DHTCollector struct {
+	Node *core.IpfsNode
+
+	mu      sync.Mutex
+	peers   map[string]map[peer.ID]struct{}
+	added   map[string]uint64
+	removed map[string]uint64
+
+	records        float64
+	recordsScanned bool
+}
+
+func (*DHTCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dhtRoutingTableSizeMetric
+	ch <- dhtRoutingTableAddedMetric
+	ch <- dhtRoutingTableRemovedMetric
+	ch <- dhtProviderRecordsMetric
+}
+
+func (c *DHTCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.DHTValues() {
+		ch <- prometheus.MustNewConstMetric(dhtRoutingTableSizeMetric, prometheus.GaugeValue, float64(s.Size), s.DHT)
+		ch <- prometheus.MustNewConstMetric(dhtRoutingTableAddedMetric, prometheus.CounterValue, float64(s.Added), s.DHT)
+		ch <- prometheus.MustNewConstMetric(dhtRoutingTableRemovedMetric, prometheus.CounterValue, float64(s.Removed), s.DHT)
+	}
+	if records, ok := c.ProviderRecordsValue(); ok {
+		ch <- prometheus.MustNewConstMetric(dhtProviderRecordsMetric, prometheus.GaugeValue, records)
+	}
+}
+
+// ProviderRecordsValue returns the number of provider records held in the
+// local datastore, as of the last scan by RefreshProviderRecords. These are
+// the records the DHT serves, including the node's own provides. Only DHT
+// servers store records for others: ok is false when neither DHT runs in
+// server mode, or before the first scan.
+func (c *DHTCollector) ProviderRecordsValue() (records float64, ok bool) {
+	if !c.dhtServer() {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.records, c.recordsScanned
+}
+
+// RefreshProviderRecords counts the provider records in the providers
+// datastore every providerRecordsScanInterval, until ctx is done. The scan
+// walks every record, which is too slow to do on each collection.
+func (c *DHTCollector) RefreshProviderRecords(ctx context.Context) {
+	for {
+		if c.dhtServer() {
+			if err := c.refreshProviderRecords(ctx); err != nil && ctx.Err() == nil {
+				log.Errorf("counting DHT provider records: %s", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(providerRecordsScanInterval):
+		}
+	}
+}
+
+func (c *DHTCollector) refreshProviderRecords(ctx context.Context) error {
+	res, err := c.Node.Repo.Datastore().Query(ctx, dsq.Query{
+		Prefix:   providers.ProvidersKeyPrefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	var n float64
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		n++
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records, c.recordsScanned = n, true
+	return nil
+}
+
+func (c *DHTCollector) dhtServer() bool {
+	return c.Node.DHT != nil && c.Node.Repo != nil &&
+		(c.Node.DHT.WAN.Mode() == dht.ModeServer || c.Node.DHT.LAN.Mode() == dht.ModeServer)
+}
+
+func (c *DHTCollector) DHTValues() []DHTRoutingTableStats {
+	if c.Node.DHT == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.peers == nil {
+		c.peers = make(map[string]map[peer.ID]struct{})
+		c.added = make(map[string]uint64)
+		c.removed = make(map[string]uint64)
+	}
+
+	tables := []struct {
+		name string
+		dht  *dht.IpfsDHT
+	}{
+		{"wan", c.Node.DHT.WAN},
+		{"lan", c.Node.DHT.LAN},
+	}
+
+	var vals []DHTRoutingTableStats
+	for _, t := range tables {
+		if t.dht == nil {
+			continue
+		}
+		name := t.name
+		current := make(map[peer.ID]struct{})
+		for _, p := range t.dht.RoutingTable().ListPeers() {
+			current[p] = struct{}{}
+		}
+
+		// The first collection only records the table, everything in it
+		// would otherwise count as added.
+		if previous, ok := c.peers[name]; ok {
+			for p := range current {
+				if _, ok := previous[p]; !ok {
+					c.added[name]++
+				}
+			}
+			for p := range previous {
+				if _, ok := current[p]; !ok {
+					c.removed[name]++
+				}
+			}
+		}
+		c.peers[name] = current
+
+		vals = append(vals, DHTRoutingTableStats{
+			DHT:     name,
+			Size:    len(current),
+			Added:   c.added[name],
+			Removed: c.removed[name],
+		})
+	}
+	return vals
+}
+
+var pinsMetric = prometheus.NewDesc(
+	"ipfs_pins",
+	"Number of pinned objects, by pin type",
+	[]string{"type"},
+	nil,
+)
+
+// pinCountInterval is how often RefreshPins counts the pins.
+const pinCountInterval = 5 * time.Minute
+
+// PinCollector reports the number of recursive and direct pins, and
+// optionally of indirect pins.
+type PinCollector struct {
+	Node *core.IpfsNode
+	// IncludeIndirect makes the collector count indirect pins too. That
+	// means walking every recursively pinned DAG, which is slow on large
+	// repos.
+	IncludeIndirect bool
+
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+func (*PinCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pinsMetric
+}
+
+func (c *PinCollector) Collect(ch chan<- prometheus.Metric) {
+	for typ, val := range c.PinsValues() {
+		ch <- prometheus.MustNewConstMetric(pinsMetric, prometheus.GaugeValue, val, typ)
+	}
+}
+
+// PinsValues returns the number of pins by type as of the last count by
+// RefreshPins, nil before the first one.
+func (c *PinCollector) PinsValues() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts
+}
+
+// RefreshPins counts the pins every pinCountInterval, until ctx is done.
+// Listing the pins, let alone walking the pinned DAGs, is too slow to do on
+// each collection. A failed count leaves the previous one in place.
+func (c *PinCollector) RefreshPins(ctx context.Context) {
+	for {
+		if err := c.refreshPins(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("counting pins: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pinCountInterval):
+		}
+	}
+}
+
+func (c *PinCollector) refreshPins(ctx context.Context) error {
+	if c.Node.Pinning == nil {
+		return nil
+	}
+	recursive, err := c.Node.Pinning.RecursiveKeys(ctx)
+	if err != nil {
+		return err
+	}
+	direct, err := c.Node.Pinning.DirectKeys(ctx)
+	if err != nil {
+		return err
+	}
+	counts := map[string]float64{
+		"recursive": float64(len(recursive)),
+		"direct":    float64(len(direct)),
+	}
+	if c.IncludeIndirect {
+		indirect, err := countIndirectPins(ctx, c.Node.Blockstore, recursive, direct)
+		if err != nil {
+			return err
+		}
+		counts["indirect"] = indirect
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = counts
+	return nil
+}
+
+// countIndirectPins counts the blocks below the recursive pins which aren't
+// pinned themselves, like `ipfs pin ls --type=indirect` does. Only the local
+// blocks are walked: missing blocks are counted but not walked past.
+func countIndirectPins(ctx context.Context, bs blockstore.Blockstore, recursive, direct []cid.Cid) (float64, error) {
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	set := cid.NewSet()
+	for _, k := range recursive {
+		err := merkledag.Walk(
+			ctx, merkledag.GetLinksWithDAG(dag), k,
+			set.Visit,
+			merkledag.SkipRoot(), merkledag.Concurrent(), merkledag.IgnoreMissing(),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, k := range recursive {
+		set.Remove(k)
+	}
+	for _, k := range direct {
+		set.Remove(k)
+	}
+	return float64(set.Len()), nil
+}
+
+var wantlistOldestAgeMetric = prometheus.NewDesc(
+	prometheus.BuildFQName("ipfs", "bitswap", "wantlist_oldest_age_seconds"),
+	"Age of the oldest entry in the bitswap wantlist, 0 when it is empty",
+	nil,
+	nil,
+)
+
+// WantlistCollector reports how long the oldest want has been waiting, which
+// points at blocks the node is unable to fetch. Bitswap doesn't keep the
+// time a want was added, so wants are timestamped when a collection first
+// sees them: ages are as precise as the scrape interval.
+type WantlistCollector struct {
+	Node *core.IpfsNode
+
+	mu        sync.Mutex
+	firstSeen map[cid.Cid]time.Time
+}
+
+func (*WantlistCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wantlistOldestAgeMetric
+}
+
+func (c *WantlistCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(wantlistOldestAgeMetric, prometheus.GaugeValue, c.OldestWantAgeValue())
+}
+
+// OldestWantAgeValue returns the age in seconds of the oldest want. Wants
+// that left the wantlist since the last collection, because the block was
+// received or the want cancelled, are forgotten.
+func (c *WantlistCollector) OldestWantAgeValue() float64 {
+	bs, ok := c.Node.Exchange.(bitswapStater)
+	if !ok {
+		return 0
+	}
+	stat, err := bs.Stat()
+	if err != nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	seen := make(map[cid.Cid]time.Time, len(stat.Wantlist))
+	oldest := now
+	for _, k := range stat.Wantlist {
+		t, ok := c.firstSeen[k]
+		if !ok {
+			t = now
+		}
+		seen[k] = t
+		if t.Before(oldest) {
+			oldest = t
+		}
+	}
+	c.firstSeen = seen
+	return now.Sub(oldest).Seconds()
+}
+
+// PushMetrics pushes the metrics gathered from g to the Prometheus
+// pushgateway at url every interval, until ctx is done. The metrics are
+// grouped under the "ipfs" job and the peer ID of the node, so that nodes
+// sharing a pushgateway don't overwrite each other. Failed pushes are logged
+// and retried on the next tick.
+func PushMetrics(ctx context.Context, g prometheus.Gatherer, url string, interval time.Duration, id peer.ID) {
+	pusher := push.New(url, "ipfs").Gatherer(g).Grouping("peer_id", id.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := pusher.PushContext(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("failed to push metrics to %s: %s", url, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+var (
+	peerRateInMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "network", "peer_rate_in_bytes_per_second"),
+		"Inbound bandwidth of the peers with the highest throughput",
+		[]string{"peer"},
+		nil,
+	)
+	peerRateOutMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("libp2p", "network", "peer_rate_out_bytes_per_second"),
+		"Outbound bandwidth of the peers with the highest throughput",
+		[]string{"peer"},
+		nil,
+	)
+)
+
+// PeerBandwidth is the current bandwidth used with a peer.
+type PeerBandwidth struct {
+	Peer    peer.ID
+	RateIn  float64
+	RateOut float64
+}
+
+// BandwidthByPeerCollector reports the bandwidth used with the TopN peers
+// with the highest combined throughput. Only a few peers are reported to
+// keep the number of series bounded, the set changes from one collection to
+// the next.
+type BandwidthByPeerCollector struct {
+	Node *core.IpfsNode
+	TopN int
+}
+
+func (BandwidthByPeerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- peerRateInMetric
+	ch <- peerRateOutMetric
+}
+
+func (c BandwidthByPeerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, bw := range c.PeerBandwidthValues() {
+		ch <- prometheus.MustNewConstMetric(peerRateInMetric, prometheus.GaugeValue, bw.RateIn, bw.Peer.String())
+		ch <- prometheus.MustNewConstMetric(peerRateOutMetric, prometheus.GaugeValue, bw.RateOut, bw.Peer.String())
+	}
+}
+
+// PeerBandwidthValues returns the bandwidth of the TopN peers, highest
+// throughput first. Nothing is returned when bandwidth metrics are disabled.
+func (c BandwidthByPeerCollector) PeerBandwidthValues() []PeerBandwidth {
+	if c.Node.Reporter == nil {
+		return nil
+	}
+	return topPeersByRate(c.Node.Reporter.GetBandwidthByPeer(), c.TopN)
+}
+
+func topPeersByRate(stats map[peer.ID]metrics.Stats, n int) []PeerBandwidth {
+	all := make([]PeerBandwidth, 0, len(stats))
+	for p, s := range stats {
+		all = append(all, PeerBandwidth{Peer: p, RateIn: s.RateIn, RateOut: s.RateOut})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		ri, rj := all[i].RateIn+all[i].RateOut, all[j].RateIn+all[j].RateOut
+		if ri != rj {
+			return ri > rj
+		}
+		return all[i].Peer < all[j].Peer
+	})
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
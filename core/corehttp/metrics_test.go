@@ -1,15 +1,52 @@
 package corehttp
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	bitswap "github.com/ipfs/go-libipfs/bitswap"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/repo"
 
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	ddht "github.com/libp2p/go-libp2p-kad-dht/dual"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
 	inet "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	tnet "github.com/libp2p/go-libp2p/core/test"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	relayclient "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // This test is based on go-libp2p/p2p/net/swarm.TestConnectednessCorrect
@@ -54,3 +91,747 @@ func TestPeersTotal(t *testing.T) {
 		t.Fatalf("expected 3 peers in either tcp or upd/quic transport, got %f", totalPeers)
 	}
 }
+
+func TestBootstrapHealth(t *testing.T) {
+	ctx := context.Background()
+
+	hosts := make([]*bhost.BasicHost, 3)
+	for i := 0; i < 3; i++ {
+		var err error
+		hosts[i], err = bhost.NewHost(swarmt.GenSwarm(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first bootstrap peer is reachable.
+	connected, disconnected := hosts[1], hosts[2]
+	swarmt.DivulgeAddresses(connected.Network(), hosts[0].Network())
+	if _, err := hosts[0].Network().DialPeer(ctx, connected.ID()); err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+
+	var cfg config.Config
+	cfg.SetBootstrapPeers([]peer.AddrInfo{
+		{ID: connected.ID(), Addrs: connected.Addrs()},
+		{ID: disconnected.ID(), Addrs: disconnected.Addrs()},
+	})
+
+	node := &core.IpfsNode{PeerHost: hosts[0], Repo: &repo.Mock{C: cfg}}
+	collector := BootstrapHealthCollector{Node: node}
+	health := collector.BootstrapHealthValues()
+	if len(health) != 2 {
+		t.Fatalf("expected health of 2 bootstrap peers, got %d", len(health))
+	}
+
+	for _, h := range health {
+		switch h.Peer {
+		case connected.ID():
+			if !h.Connected || h.LastSeen.IsZero() {
+				t.Fatalf("expected %s to be connected and seen, got %+v", h.Peer, h)
+			}
+		case disconnected.ID():
+			if h.Connected || !h.LastSeen.IsZero() {
+				t.Fatalf("expected %s to be disconnected and never seen, got %+v", h.Peer, h)
+			}
+		default:
+			t.Fatalf("unexpected peer %s", h.Peer)
+		}
+	}
+}
+
+type protectingConnMgr struct {
+	connmgr.NullConnMgr
+	protected peer.ID
+}
+
+func (cm protectingConnMgr) IsProtected(p peer.ID, _ string) bool {
+	return p == cm.protected
+}
+
+func TestProtectedPeers(t *testing.T) {
+	ctx := context.Background()
+
+	hosts := make([]*bhost.BasicHost, 3)
+	for i := 1; i < 3; i++ {
+		var err error
+		hosts[i], err = bhost.NewHost(swarmt.GenSwarm(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cm := protectingConnMgr{protected: hosts[1].ID()}
+	var err error
+	hosts[0], err = bhost.NewHost(swarmt.GenSwarm(t), &bhost.HostOpts{ConnManager: cm})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range hosts[1:] {
+		swarmt.DivulgeAddresses(h.Network(), hosts[0].Network())
+		if _, err := hosts[0].Network().DialPeer(ctx, h.ID()); err != nil {
+			t.Fatalf("Failed to dial: %s", err)
+		}
+	}
+
+	node := &core.IpfsNode{PeerHost: hosts[0]}
+	collector := IpfsNodeCollector{Node: node}
+	if protected := collector.ProtectedPeersValue(); protected != 1 {
+		t.Fatalf("expected 1 protected peer, got %f", protected)
+	}
+}
+
+func TestFilteredAddrs(t *testing.T) {
+	h, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Network().Listen(ma.StringCast("/ip4/127.0.0.2/tcp/0")); err != nil {
+		t.Fatal(err)
+	}
+
+	filters := ma.NewFilters()
+	_, ipnet, err := net.ParseCIDR("127.0.0.2/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters.AddFilter(*ipnet, ma.ActionDeny)
+
+	node := &core.IpfsNode{PeerHost: h, Filters: filters}
+	collector := IpfsNodeCollector{Node: node}
+	advertised, filtered := collector.AddrsValues()
+	if advertised != 2 || filtered != 1 {
+		t.Fatalf("expected 1 of 2 addresses to be filtered, got %f of %f (addrs: %v)", filtered, advertised, h.Addrs())
+	}
+}
+
+func TestProtocolHandlers(t *testing.T) {
+	h, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: h}}
+	before := collector.ProtocolHandlersValue()
+
+	for _, proto := range []protocol.ID{"/test/a/1.0.0", "/test/b/1.0.0"} {
+		h.SetStreamHandler(proto, func(s inet.Stream) { s.Close() })
+	}
+	if handlers := collector.ProtocolHandlersValue(); handlers != before+2 {
+		t.Fatalf("expected %f protocol handlers, got %f", before+2, handlers)
+	}
+
+	h.RemoveStreamHandler("/test/a/1.0.0")
+	if handlers := collector.ProtocolHandlersValue(); handlers != before+1 {
+		t.Fatalf("expected %f protocol handlers, got %f", before+1, handlers)
+	}
+}
+
+func TestPeersLatency(t *testing.T) {
+	ctx := context.Background()
+
+	hosts := make([]*bhost.BasicHost, 4)
+	for i := range hosts {
+		var err error
+		hosts[i], err = bhost.NewHost(swarmt.GenSwarm(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hosts[i].Close()
+	}
+	for _, h := range hosts[1:] {
+		swarmt.DivulgeAddresses(h.Network(), hosts[0].Network())
+		if _, err := hosts[0].Network().DialPeer(ctx, h.ID()); err != nil {
+			t.Fatalf("Failed to dial: %s", err)
+		}
+	}
+
+	// The last peer's latency is unknown.
+	ps := hosts[0].Peerstore()
+	ps.RecordLatency(hosts[1].ID(), 20*time.Millisecond)
+	ps.RecordLatency(hosts[2].ID(), 300*time.Millisecond)
+
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: hosts[0]}}
+	count, sum, buckets := collector.PeersLatencyValues()
+	if count != 2 {
+		t.Fatalf("expected 2 peers with a known latency, got %d", count)
+	}
+	if sum < 0.319 || sum > 0.321 {
+		t.Fatalf("expected a latency sum of 0.32s, got %f", sum)
+	}
+	if buckets[0.01] != 0 || buckets[0.025] != 1 || buckets[0.25] != 1 || buckets[0.5] != 2 {
+		t.Fatalf("unexpected latency buckets %v", buckets)
+	}
+}
+
+func TestPeersByAgent(t *testing.T) {
+	ctx := context.Background()
+
+	hosts := make([]*bhost.BasicHost, 5)
+	for i := range hosts {
+		var err error
+		hosts[i], err = bhost.NewHost(swarmt.GenSwarm(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hosts[i].Close()
+	}
+	for _, h := range hosts[1:] {
+		swarmt.DivulgeAddresses(h.Network(), hosts[0].Network())
+		if _, err := hosts[0].Network().DialPeer(ctx, h.ID()); err != nil {
+			t.Fatalf("Failed to dial: %s", err)
+		}
+	}
+
+	// Set the agents as identify would, leaving the last peer unidentified.
+	ps := hosts[0].Peerstore()
+	for i, agent := range []string{"kubo/0.18.0", "kubo/0.18.0", "kubo/0.17.0"} {
+		if err := ps.Put(hosts[i+1].ID(), "AgentVersion", agent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: hosts[0]}}
+	expected := map[string]float64{"kubo/0.18.0": 2, "kubo/0.17.0": 1, "unknown": 1}
+	if agents := collector.PeersByAgentValues(10); !reflect.DeepEqual(agents, expected) {
+		t.Fatalf("expected %v, got %v", expected, agents)
+	}
+
+	expected = map[string]float64{"kubo/0.18.0": 2, "other": 2}
+	if agents := collector.PeersByAgentValues(1); !reflect.DeepEqual(agents, expected) {
+		t.Fatalf("expected %v, got %v", expected, agents)
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"kubo/0.18.0", "kubo/0.18.0"},
+		{"kubo/\xff\xfe", "kubo/\uFFFD"},
+		{strings.Repeat("a", maxLabelValueLen+10), strings.Repeat("a", maxLabelValueLen)},
+		// don't cut a multi-byte character in half
+		{strings.Repeat("a", maxLabelValueLen-1) + "é", strings.Repeat("a", maxLabelValueLen-1)},
+	} {
+		if out := labelValue(tc.in); out != tc.out {
+			t.Errorf("expected %q for %q, got %q", tc.out, tc.in, out)
+		}
+		if !utf8.ValidString(labelValue(tc.in)) {
+			t.Errorf("label value for %q is not valid UTF-8", tc.in)
+		}
+	}
+}
+
+// stubHost exposes a fixed set of connections.
+type stubHost struct {
+	host.Host
+	conns []inet.Conn
+	rcmgr inet.ResourceManager
+}
+
+func (h stubHost) Network() inet.Network { return stubNetwork{conns: h.conns, rcmgr: h.rcmgr} }
+
+type stubNetwork struct {
+	inet.Network
+	conns []inet.Conn
+	rcmgr inet.ResourceManager
+}
+
+func (n stubNetwork) Conns() []inet.Conn                    { return n.conns }
+func (n stubNetwork) ResourceManager() inet.ResourceManager { return n.rcmgr }
+
+type stubConn struct {
+	inet.Conn
+	stat inet.ConnStats
+}
+
+func (c stubConn) Stat() inet.ConnStats { return c.stat }
+
+func TestTransientConns(t *testing.T) {
+	limited := stubConn{stat: inet.ConnStats{Stats: inet.Stats{Transient: true}}}
+	direct := stubConn{}
+	node := &core.IpfsNode{PeerHost: stubHost{conns: []inet.Conn{direct, limited, direct}}}
+	collector := IpfsNodeCollector{Node: node}
+	if transient := collector.TransientConnsValue(); transient != 1 {
+		t.Fatalf("expected 1 transient connection, got %f", transient)
+	}
+}
+
+func TestRcmgrSystem(t *testing.T) {
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: stubHost{rcmgr: &inet.NullResourceManager{}}}}
+	if used, limit := collector.RcmgrSystemValues(); len(used) != 0 || len(limit) != 0 {
+		t.Fatalf("expected no values with the null resource manager, got %v and %v", used, limit)
+	}
+
+	limits := rcmgr.DefaultLimits.AutoScale()
+	limits.System.Conns = 2
+	limits.System.Streams = 4
+	limits.System.Memory = 1 << 20
+	mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+
+	conn, err := mgr.OpenConnection(inet.DirOutbound, true, ma.StringCast("/ip4/1.2.3.4/tcp/4001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Done()
+	if err := conn.ReserveMemory(1024, inet.ReservationPriorityAlways); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ReleaseMemory(1024)
+
+	collector = IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: stubHost{rcmgr: mgr}}}
+	used, limit := collector.RcmgrSystemValues()
+	expectedUsed := map[string]float64{"conns": 1, "streams": 0, "memory": 1024}
+	if !reflect.DeepEqual(used, expectedUsed) {
+		t.Fatalf("expected %v in use, got %v", expectedUsed, used)
+	}
+	expectedLimit := map[string]float64{"conns": 2, "streams": 4, "memory": 1 << 20}
+	if !reflect.DeepEqual(limit, expectedLimit) {
+		t.Fatalf("expected %v limits, got %v", expectedLimit, limit)
+	}
+}
+
+// stubBitswap reports a fixed set of bitswap peers.
+type stubBitswap struct {
+	exchange.Interface
+	peers    []string
+	wantlist []cid.Cid
+}
+
+func (bs stubBitswap) Stat() (*bitswap.Stat, error) {
+	return &bitswap.Stat{Peers: bs.peers, Wantlist: bs.wantlist}, nil
+}
+
+func TestBroadcastFanout(t *testing.T) {
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{}}
+	if fanout := collector.BroadcastFanoutValue(); fanout != 0 {
+		t.Fatalf("expected no fanout without bitswap, got %f", fanout)
+	}
+
+	node := &core.IpfsNode{Exchange: stubBitswap{peers: []string{"a", "b", "c"}}}
+	collector = IpfsNodeCollector{Node: node}
+	if fanout := collector.BroadcastFanoutValue(); fanout != 3 {
+		t.Fatalf("expected a fanout of 3 peers, got %f", fanout)
+	}
+}
+
+func TestDHTRoutingTable(t *testing.T) {
+	collector := &DHTCollector{Node: &core.IpfsNode{}}
+	if vals := collector.DHTValues(); vals != nil {
+		t.Fatalf("expected no values without a DHT, got %v", vals)
+	}
+
+	ctx := context.Background()
+	h, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	// The peers added below are not connected, which the WAN diversity
+	// filter would reject.
+	d, err := ddht.New(ctx, h, ddht.WanDHTOption(dht.RoutingTablePeerDiversityFilter(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	collector = &DHTCollector{Node: &core.IpfsNode{DHT: d}}
+
+	expect := func(want ...DHTRoutingTableStats) {
+		t.Helper()
+		if got := collector.DHTValues(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	addPeer := func(d *dht.IpfsDHT) peer.ID {
+		t.Helper()
+		p := tnet.RandPeerIDFatal(t)
+		if ok, err := d.RoutingTable().TryAddPeer(p, true, false); !ok || err != nil {
+			t.Fatalf("failed to add peer to the routing table: %v", err)
+		}
+		return p
+	}
+
+	expect(
+		DHTRoutingTableStats{DHT: "wan"},
+		DHTRoutingTableStats{DHT: "lan"},
+	)
+
+	wanPeer := addPeer(d.WAN)
+	addPeer(d.WAN)
+	addPeer(d.LAN)
+	expect(
+		DHTRoutingTableStats{DHT: "wan", Size: 2, Added: 2},
+		DHTRoutingTableStats{DHT: "lan", Size: 1, Added: 1},
+	)
+
+	d.WAN.RoutingTable().RemovePeer(wanPeer)
+	expect(
+		DHTRoutingTableStats{DHT: "wan", Size: 1, Added: 2, Removed: 1},
+		DHTRoutingTableStats{DHT: "lan", Size: 1, Added: 1},
+	)
+}
+
+type stubPinner struct {
+	pin.Pinner
+	direct, recursive []cid.Cid
+	err               error
+}
+
+func (p *stubPinner) DirectKeys(context.Context) ([]cid.Cid, error) {
+	return p.direct, p.err
+}
+
+func (p *stubPinner) RecursiveKeys(context.Context) ([]cid.Cid, error) {
+	return p.recursive, p.err
+}
+
+func TestPins(t *testing.T) {
+	ctx := context.Background()
+	c1 := cid.NewCidV1(cid.Raw, []byte("a"))
+	c2 := cid.NewCidV1(cid.Raw, []byte("b"))
+	pinner := &stubPinner{direct: []cid.Cid{c1}, recursive: []cid.Cid{c1, c2}}
+	collector := &PinCollector{Node: &core.IpfsNode{Pinning: pinner}}
+
+	if got := collector.PinsValues(); got != nil {
+		t.Fatalf("expected no counts before the first refresh, got %v", got)
+	}
+
+	want := map[string]float64{"direct": 1, "recursive": 2}
+	if err := collector.refreshPins(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := collector.PinsValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// A failed listing keeps the last known counts.
+	pinner.direct = nil
+	pinner.err = errors.New("listing failed")
+	if err := collector.refreshPins(ctx); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if got := collector.PinsValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected cached %v, got %v", want, got)
+	}
+}
+
+func TestIndirectPins(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewGCBlockstore(blockstore.NewBlockstore(syncds.MutexWrap(datastore.NewMapDatastore())), blockstore.NewGCLocker())
+
+	leaf := merkledag.NewRawNode([]byte("leaf"))
+	pinnedLeaf := merkledag.NewRawNode([]byte("pinned leaf"))
+	missing := merkledag.NewRawNode([]byte("missing"))
+	root := merkledag.NodeWithData(nil)
+	for _, n := range []ipld.Node{leaf, pinnedLeaf, missing} {
+		if err := root.AddNodeLink(n.Cid().String(), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []ipld.Node{leaf, pinnedLeaf, root} {
+		if err := bs.Put(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pinner := &stubPinner{direct: []cid.Cid{pinnedLeaf.Cid()}, recursive: []cid.Cid{root.Cid()}}
+	node := &core.IpfsNode{Pinning: pinner, Blockstore: bs}
+
+	// Indirect pins are only counted when asked for.
+	collector := &PinCollector{Node: node}
+	if err := collector.refreshPins(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"direct": 1, "recursive": 1}
+	if got := collector.PinsValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// The directly pinned leaf doesn't count, the missing block does
+	// although the walk can't go past it.
+	collector = &PinCollector{Node: node, IncludeIndirect: true}
+	if err := collector.refreshPins(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]float64{"direct": 1, "recursive": 1, "indirect": 2}
+	if got := collector.PinsValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPubsubTopicPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if vals := (IpfsNodeCollector{Node: &core.IpfsNode{}}).PubsubTopicPeersValues(); vals != nil {
+		t.Fatalf("expected no values without pubsub, got %v", vals)
+	}
+
+	mn, err := mocknet.FullMeshLinked(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mn.Close()
+
+	psubs := make([]*pubsub.PubSub, 3)
+	for i, h := range mn.Hosts() {
+		if psubs[i], err = pubsub.NewFloodSub(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// We share "a" with both peers, "b" with one and don't join "c".
+	for i, topics := range [][]string{{"a", "b"}, {"a", "b", "c"}, {"a", "c"}} {
+		for _, topic := range topics {
+			if _, err := psubs[i].Subscribe(topic); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PubSub: psubs[0]}}
+	want := map[string]float64{"a": 2, "b": 1}
+	var got map[string]float64
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if got = collector.PubsubTopicPeersValues(); reflect.DeepEqual(got, want) {
+			return
+		}
+	}
+	t.Fatalf("expected %v, got %v", want, got)
+}
+
+func TestWantlistOldestAge(t *testing.T) {
+	stuck := cid.NewCidV1(cid.Raw, []byte("stuck"))
+	fresh := cid.NewCidV1(cid.Raw, []byte("fresh"))
+	collector := &WantlistCollector{Node: &core.IpfsNode{Exchange: stubBitswap{wantlist: []cid.Cid{stuck}}}}
+	if age := collector.OldestWantAgeValue(); age > 1 {
+		t.Fatalf("expected a new want, got an age of %fs", age)
+	}
+
+	// Pretend the want was first seen an hour ago.
+	collector.firstSeen[stuck] = time.Now().Add(-time.Hour)
+	collector.Node.Exchange = stubBitswap{wantlist: []cid.Cid{stuck, fresh}}
+	if age := collector.OldestWantAgeValue(); age < time.Hour.Seconds() {
+		t.Fatalf("expected an age of at least an hour, got %fs", age)
+	}
+
+	// Once the block arrives its want is forgotten.
+	collector.Node.Exchange = stubBitswap{wantlist: []cid.Cid{fresh}}
+	if age := collector.OldestWantAgeValue(); age > time.Hour.Seconds()/2 {
+		t.Fatalf("expected the stuck want to be gone, got an age of %fs", age)
+	}
+	if _, ok := collector.firstSeen[stuck]; ok {
+		t.Fatal("fulfilled want is still tracked")
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_pushed_total"})
+	reg.MustRegister(counter)
+	counter.Inc()
+
+	// The first push fails, the following ones must still be attempted.
+	pushes := make(chan *http.Request, 10)
+	var failed bool
+	var mu sync.Mutex
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Contains(body, []byte("test_pushed_total")) {
+			t.Errorf("pushed metrics are missing the test counter")
+		}
+		select {
+		case pushes <- r:
+		default:
+		}
+	}))
+	defer gateway.Close()
+
+	id := peer.ID("node")
+	done := make(chan struct{})
+	go func() {
+		PushMetrics(ctx, reg, gateway.URL, 10*time.Millisecond, id)
+		close(done)
+	}()
+
+	select {
+	case r := <-pushes:
+		if want := "/metrics/job/ipfs/peer_id/" + id.String(); r.URL.Path != want {
+			t.Fatalf("expected a push to %s, got %s", want, r.URL.Path)
+		}
+		if r.Method != http.MethodPut {
+			t.Fatalf("expected the group to be replaced with PUT, got %s", r.Method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("metrics were not pushed")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestTopPeersByRate(t *testing.T) {
+	stats := map[peer.ID]metrics.Stats{
+		"idle":     {},
+		"download": {RateIn: 100, RateOut: 1},
+		"upload":   {RateIn: 1, RateOut: 50},
+		"balanced": {RateIn: 30, RateOut: 30},
+	}
+	want := []PeerBandwidth{
+		{Peer: "download", RateIn: 100, RateOut: 1},
+		{Peer: "balanced", RateIn: 30, RateOut: 30},
+	}
+	if got := topPeersByRate(stats, 2); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := topPeersByRate(stats, 10); len(got) != len(stats) {
+		t.Fatalf("expected all %d peers, got %v", len(stats), got)
+	}
+
+	collector := BandwidthByPeerCollector{Node: &core.IpfsNode{}, TopN: 2}
+	if vals := collector.PeerBandwidthValues(); vals != nil {
+		t.Fatalf("expected no values without a bandwidth reporter, got %v", vals)
+	}
+}
+
+// addrsHost advertises a fixed set of addresses.
+type addrsHost struct {
+	host.Host
+	addrs []ma.Multiaddr
+}
+
+func (h addrsHost) Addrs() []ma.Multiaddr { return h.addrs }
+
+func TestRelayReservations(t *testing.T) {
+	relay1 := "/ip4/1.2.3.4/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN/p2p-circuit"
+	relay2 := "/ip4/5.6.7.8/tcp/4001/p2p/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa/p2p-circuit"
+	h := addrsHost{addrs: []ma.Multiaddr{
+		ma.StringCast("/ip4/10.0.0.1/tcp/4001"),
+		ma.StringCast(relay1),
+		// The same relay over another transport is the same reservation.
+		ma.StringCast("/ip4/1.2.3.4/udp/4001/quic/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN/p2p-circuit"),
+		ma.StringCast(relay2),
+	}}
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: h}}
+	if reservations := collector.RelayReservationsValue(); reservations != 2 {
+		t.Fatalf("expected 2 reservations, got %f", reservations)
+	}
+}
+
+func TestRelayCircuits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	newHost := func(opts ...libp2p.Option) host.Host {
+		h, err := libp2p.New(append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	relayHost := newHost(libp2p.EnableRelayService(), libp2p.ForceReachabilityPublic())
+	dest := newHost(libp2p.EnableRelay())
+	src := newHost(libp2p.EnableRelay())
+
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: relayHost}}
+	if circuits := collector.RelayCircuitsValue(); circuits != 0 {
+		t.Fatalf("expected no circuits, got %f", circuits)
+	}
+
+	relayInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	if err := dest.Connect(ctx, relayInfo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relayclient.Reserve(ctx, dest, relayInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	circuitAddr := ma.StringCast("/p2p/" + relayHost.ID().String() + "/p2p-circuit")
+	src.Peerstore().AddAddrs(relayHost.ID(), relayHost.Addrs(), time.Hour)
+	if err := src.Connect(ctx, peer.AddrInfo{ID: dest.ID(), Addrs: []ma.Multiaddr{circuitAddr}}); err != nil {
+		t.Fatal(err)
+	}
+	if circuits := collector.RelayCircuitsValue(); circuits != 1 {
+		t.Fatalf("expected 1 circuit, got %f", circuits)
+	}
+}
+
+func TestDHTProviderRecords(t *testing.T) {
+	ctx := context.Background()
+	newDHT := func(mode dht.ModeOpt) *ddht.DHT {
+		h, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		d, err := ddht.New(ctx, h, ddht.DHTOption(dht.Mode(mode)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { d.Close() })
+		return d
+	}
+
+	// Provider records as the DHT's provider manager stores them.
+	ds := syncds.MutexWrap(datastore.NewMapDatastore())
+	addRecord := func() {
+		key := datastore.NewKey(providers.ProvidersKeyPrefix + tnet.RandPeerIDFatal(t).String() + "/" + tnet.RandPeerIDFatal(t).String())
+		if err := ds.Put(ctx, key, []byte{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addRecord()
+	addRecord()
+	if err := ds.Put(ctx, datastore.NewKey("/blocks/other"), []byte{}); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &DHTCollector{Node: &core.IpfsNode{DHT: newDHT(dht.ModeClient), Repo: &repo.Mock{D: ds}}}
+	if err := collector.refreshProviderRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := collector.ProviderRecordsValue(); ok {
+		t.Fatal("expected no provider records for a DHT client")
+	}
+
+	collector = &DHTCollector{Node: &core.IpfsNode{DHT: newDHT(dht.ModeServer), Repo: &repo.Mock{D: ds}}}
+	if _, ok := collector.ProviderRecordsValue(); ok {
+		t.Fatal("expected no provider records before the first scan")
+	}
+	if err := collector.refreshProviderRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if records, ok := collector.ProviderRecordsValue(); !ok || records != 2 {
+		t.Fatalf("expected 2 provider records, got %f", records)
+	}
+
+	// Collections report the last count until the next scan.
+	addRecord()
+	if records, _ := collector.ProviderRecordsValue(); records != 2 {
+		t.Fatalf("expected the cached count of 2 provider records, got %f", records)
+	}
+	if err := collector.refreshProviderRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := collector.ProviderRecordsValue(); records != 3 {
+		t.Fatalf("expected 3 provider records, got %f", records)
+	}
+}
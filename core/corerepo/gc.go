@@ -14,10 +14,40 @@ import (
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
 	"github.com/ipfs/go-mfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var log = logging.Logger("corerepo")
 
+// Reasons for running a garbage collection, as reported by gcRuns.
+const (
+	gcReasonManual   = "manual"
+	gcReasonPeriodic = "periodic"
+	gcReasonStorage  = "storage-threshold"
+)
+
+var gcRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ipfs_gc_runs_total",
+	Help: "Number of repo garbage collections, by what triggered them.",
+}, []string{"reason"})
+
+var (
+	gcRemovedBlocks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_gc_removed_blocks_total",
+		Help: "Number of blocks removed by repo garbage collections.",
+	})
+	gcErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_gc_errors_total",
+		Help: "Number of errors reported by repo garbage collections.",
+	})
+	gcDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ipfs_gc_duration_seconds",
+		Help:    "Time taken by repo garbage collections.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 8),
+	})
+)
+
 var ErrMaxStorageExceeded = errors.New("maximum storage limit exceeded. Try to unpin some files")
 
 type GC struct {
@@ -90,7 +120,31 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	}
 	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
 
-	return CollectResult(ctx, rmed, nil)
+	return CollectResult(ctx, observeGC(ctx, rmed), nil)
+}
+
+// observeGC forwards the results of a garbage collection, recording how many
+// blocks it removed, its errors, and how long it took once it is done.
+func observeGC(ctx context.Context, in <-chan gc.Result) <-chan gc.Result {
+	start := time.Now()
+	out := make(chan gc.Result, cap(in))
+	go func() {
+		defer close(out)
+		for res := range in {
+			if res.Error != nil {
+				gcErrors.Inc()
+			} else if res.KeyRemoved.Defined() {
+				gcRemovedBlocks.Inc()
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+		gcDuration.Observe(time.Since(start).Seconds())
+	}()
+	return out
 }
 
 // CollectResult collects the output of a garbage collection run and calls the
@@ -148,6 +202,8 @@ func (e *MultiError) Error() string {
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+	gcRuns.WithLabelValues(gcReasonManual).Inc()
+
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
 		out := make(chan gc.Result)
@@ -156,7 +212,7 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result
 		return out
 	}
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	return observeGC(ctx, gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots))
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -189,7 +245,7 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 			return nil
 		case <-time.After(period):
 			// the private func maybeGC doesn't compute storageMax, storageGC, slackGC so that they are not re-computed for every cycle
-			if err := gc.maybeGC(ctx, 0); err != nil {
+			if err := gc.maybeGC(ctx, 0, gcReasonPeriodic); err != nil {
 				log.Error(err)
 			}
 		}
@@ -201,10 +257,10 @@ func ConditionalGC(ctx context.Context, node *core.IpfsNode, offset uint64) erro
 	if err != nil {
 		return err
 	}
-	return gc.maybeGC(ctx, offset)
+	return gc.maybeGC(ctx, offset, gcReasonStorage)
 }
 
-func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
+func (gc *GC) maybeGC(ctx context.Context, offset uint64, reason string) error {
 	storage, err := gc.Repo.GetStorageUsage(ctx)
 	if err != nil {
 		return err
@@ -217,6 +273,7 @@ func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 
 		// Do GC here
 		log.Info("Watermark exceeded. Starting repo GC...")
+		gcRuns.WithLabelValues(reason).Inc()
 
 		if err := GarbageCollect(gc.Node, ctx); err != nil {
 			return err
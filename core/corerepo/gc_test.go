@@ -0,0 +1,103 @@
+package corerepo
+
+import (
+	"context"
+	"testing"
+
+	coremock "github.com/ipfs/kubo/core/mock"
+
+	"github.com/ipfs/go-cid"
+	blocks "github.com/ipfs/go-libipfs/blocks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestGCRunsByReason(t *testing.T) {
+	ctx := context.Background()
+	node, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	// Any addition goes above the watermark.
+	cfg, err := node.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Datastore.StorageMax = "1B"
+	cfg.Datastore.StorageGCWatermark = 90
+
+	runs := func(reason string) float64 {
+		return testutil.ToFloat64(gcRuns.WithLabelValues(reason))
+	}
+	manual, periodic, storage := runs(gcReasonManual), runs(gcReasonPeriodic), runs(gcReasonStorage)
+
+	if err := CollectResult(ctx, GarbageCollectAsync(node, ctx), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConditionalGC(ctx, node, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConditionalGC(ctx, node, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runs(gcReasonManual) - manual; got != 1 {
+		t.Fatalf("expected 1 manual gc run, got %f", got)
+	}
+	if got := runs(gcReasonStorage) - storage; got != 1 {
+		t.Fatalf("expected 1 storage-threshold gc run, got %f", got)
+	}
+	if got := runs(gcReasonPeriodic) - periodic; got != 0 {
+		t.Fatalf("expected no periodic gc run, got %f", got)
+	}
+}
+
+func TestGCMetrics(t *testing.T) {
+	ctx := context.Background()
+	node, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	// Unpinned blocks are collected.
+	for _, data := range []string{"foo", "bar"} {
+		if err := node.Blockstore.Put(ctx, blocks.NewBlock([]byte(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed := testutil.ToFloat64(gcRemovedBlocks)
+	errs := testutil.ToFloat64(gcErrors)
+	runs := histogramCount(t, gcDuration)
+
+	var collected int
+	if err := CollectResult(ctx, GarbageCollectAsync(node, ctx), func(cid.Cid) { collected++ }); err != nil {
+		t.Fatal(err)
+	}
+	if collected < 2 {
+		t.Fatalf("expected at least 2 blocks to be collected, got %d", collected)
+	}
+
+	if got := testutil.ToFloat64(gcRemovedBlocks) - removed; got != float64(collected) {
+		t.Fatalf("expected %d removed blocks, got %f", collected, got)
+	}
+	if got := testutil.ToFloat64(gcErrors) - errs; got != 0 {
+		t.Fatalf("expected no gc errors, got %f", got)
+	}
+	if got := histogramCount(t, gcDuration) - runs; got != 1 {
+		t.Fatalf("expected the gc duration to be recorded once, got %d", got)
+	}
+}
+
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
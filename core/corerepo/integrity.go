@@ -0,0 +1,159 @@
+package corerepo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	integrityCheckedBlocks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_blockstore_integrity_checked_blocks_total",
+		Help: "Number of blocks verified by the periodic integrity check.",
+	})
+	integrityCorruptedBlocks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_blockstore_corruption_detected_total",
+		Help: "Number of blocks whose content did not match their CID during the periodic integrity check.",
+	})
+	pinsMissingRoots = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_pins_missing_roots",
+		Help: "Number of sampled pins whose root block was missing from the blockstore in the last integrity check. Only updated when Datastore.IntegrityCheckInterval is set.",
+	})
+)
+
+// PeriodicIntegrityCheck verifies a random sample of the node's blocks and
+// pins every Datastore.IntegrityCheckInterval, until ctx is done. It returns
+// immediately if the check is disabled.
+func PeriodicIntegrityCheck(ctx context.Context, node *core.IpfsNode) error {
+	cfg, err := node.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	period := cfg.Datastore.IntegrityCheckInterval.WithDefault(config.DefaultIntegrityCheckInterval)
+	if period == 0 {
+		return nil
+	}
+	sampleSize := int(cfg.Datastore.IntegrityCheckSampleSize.WithDefault(config.DefaultIntegrityCheckSampleSize))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(period):
+			checked, corrupted, err := CheckIntegrity(ctx, node.Blockstore, sampleSize)
+			if err != nil {
+				log.Errorf("blockstore integrity check: %s", err)
+			} else if corrupted > 0 {
+				log.Errorf("blockstore integrity check: %d of %d sampled blocks are corrupted", corrupted, checked)
+			}
+
+			checked, missing, err := CheckPinnedRoots(ctx, node.Pinning, node.Blockstore, sampleSize)
+			if err != nil {
+				log.Errorf("pin integrity check: %s", err)
+				continue
+			}
+			if missing > 0 {
+				log.Errorf("pin integrity check: %d of %d sampled pins are missing their root block", missing, checked)
+			}
+		}
+	}
+}
+
+// CheckIntegrity reads back up to sampleSize blocks picked at random from bs
+// and verifies that their content hashes to their CID. It returns the number
+// of blocks checked and how many of those were corrupted.
+func CheckIntegrity(ctx context.Context, bs blockstore.Blockstore, sampleSize int) (checked, corrupted int, err error) {
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// reservoir sampling, so we don't have to hold all the keys in memory
+	sample := make([]cid.Cid, 0, sampleSize)
+	seen := 0
+	for c := range keys {
+		seen++
+		if len(sample) < sampleSize {
+			sample = append(sample, c)
+		} else if i := rand.Intn(seen); i < sampleSize {
+			sample[i] = c
+		}
+	}
+	if ctx.Err() != nil {
+		return 0, 0, ctx.Err()
+	}
+
+	for _, c := range sample {
+		blk, err := bs.Get(ctx, c)
+		switch {
+		case errors.Is(err, blockstore.ErrHashMismatch):
+			// the blockstore is already verifying reads (HashOnRead)
+			corrupted++
+		case ipld.IsNotFound(err):
+			// removed since we listed it, most likely by GC
+			continue
+		case err != nil:
+			return checked, corrupted, err
+		default:
+			sum, err := c.Prefix().Sum(blk.RawData())
+			if err != nil {
+				return checked, corrupted, err
+			}
+			if !sum.Equals(c) {
+				corrupted++
+			}
+		}
+		checked++
+	}
+
+	integrityCheckedBlocks.Add(float64(checked))
+	integrityCorruptedBlocks.Add(float64(corrupted))
+	return checked, corrupted, nil
+}
+
+// CheckPinnedRoots picks up to sampleSize direct and recursive pins at random
+// and checks that their root block is present in bs. Only the roots are
+// checked; walking every pinned DAG would cost as much as a GC. It returns the
+// number of pins checked and how many of those were missing.
+func CheckPinnedRoots(ctx context.Context, pinning pin.Pinner, bs blockstore.Blockstore, sampleSize int) (checked, missing int, err error) {
+	direct, err := pinning.DirectKeys(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	recursive, err := pinning.RecursiveKeys(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pins := append(direct, recursive...)
+	rand.Shuffle(len(pins), func(i, j int) { pins[i], pins[j] = pins[j], pins[i] })
+	if len(pins) > sampleSize {
+		pins = pins[:sampleSize]
+	}
+
+	for _, c := range pins {
+		has, err := bs.Has(ctx, c)
+		if err != nil {
+			return checked, missing, err
+		}
+		if !has {
+			missing++
+		}
+		checked++
+	}
+
+	pinsMissingRoots.Set(float64(missing))
+	return checked, missing, nil
+}
@@ -0,0 +1,115 @@
+package corerepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	blocks "github.com/ipfs/go-libipfs/blocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// corruptingBlockstore returns garbage for the block with the given CID.
+type corruptingBlockstore struct {
+	blockstore.Blockstore
+	corrupt cid.Cid
+}
+
+func (bs corruptingBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if c.Equals(bs.corrupt) {
+		return blocks.NewBlockWithCid([]byte("bit rot"), c)
+	}
+	return bs.Blockstore.Get(ctx, c)
+}
+
+// stubPinner only reports the pinned keys.
+type stubPinner struct {
+	pin.Pinner
+	direct, recursive []cid.Cid
+}
+
+func (p stubPinner) DirectKeys(context.Context) ([]cid.Cid, error) {
+	return p.direct, nil
+}
+
+func (p stubPinner) RecursiveKeys(context.Context) ([]cid.Cid, error) {
+	return p.recursive, nil
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	var stored []blocks.Block
+	for _, data := range []string{"foo", "bar", "baz"} {
+		blk := blocks.NewBlock([]byte(data))
+		if err := bs.Put(ctx, blk); err != nil {
+			t.Fatal(err)
+		}
+		stored = append(stored, blk)
+	}
+
+	checked, corrupted, err := CheckIntegrity(ctx, bs, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 3 || corrupted != 0 {
+		t.Fatalf("expected 3 healthy blocks, got %d checked and %d corrupted", checked, corrupted)
+	}
+
+	// The blockstore is keyed by multihash, so it lists raw CIDs.
+	corrupt := cid.NewCidV1(cid.Raw, stored[1].Cid().Hash())
+	checked, corrupted, err = CheckIntegrity(ctx, corruptingBlockstore{bs, corrupt}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 3 || corrupted != 1 {
+		t.Fatalf("expected 1 corrupted block out of 3, got %d checked and %d corrupted", checked, corrupted)
+	}
+
+	checked, _, err = CheckIntegrity(ctx, bs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 2 {
+		t.Fatalf("expected the sample to be bounded to 2 blocks, got %d", checked)
+	}
+}
+
+func TestCheckPinnedRoots(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	present := blocks.NewBlock([]byte("present"))
+	if err := bs.Put(ctx, present); err != nil {
+		t.Fatal(err)
+	}
+	absent := blocks.NewBlock([]byte("absent"))
+
+	pinner := stubPinner{
+		direct:    []cid.Cid{present.Cid()},
+		recursive: []cid.Cid{absent.Cid()},
+	}
+	checked, missing, err := CheckPinnedRoots(ctx, pinner, bs, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 2 || missing != 1 {
+		t.Fatalf("expected 1 missing pin out of 2, got %d checked and %d missing", checked, missing)
+	}
+	if v := testutil.ToFloat64(pinsMissingRoots); v != 1 {
+		t.Fatalf("expected the missing pins gauge to be 1, got %v", v)
+	}
+
+	checked, _, err = CheckPinnedRoots(ctx, pinner, bs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 1 {
+		t.Fatalf("expected the sample to be bounded to 1 pin, got %d", checked)
+	}
+}
@@ -35,6 +35,9 @@ var BaseLibP2P = fx.Options(
 	fx.Provide(libp2p.DiscoveryHandler),
 
 	fx.Invoke(libp2p.PNetChecker),
+	fx.Invoke(libp2p.NetworkMetrics),
+	fx.Invoke(libp2p.AutoNATMetrics),
+	fx.Invoke(libp2p.AddrsMetrics),
 )
 
 func LibP2P(bcfg *BuildCfg, cfg *config.Config) fx.Option {
@@ -39,7 +39,11 @@ func Namesys(cacheSize int) func(rt irouting.ProvideManyRouter, rslv *madns.Reso
 			opts = append(opts, namesys.WithCache(cacheSize))
 		}
 
-		return namesys.NewNameSystem(rt, opts...)
+		ns, err := namesys.NewNameSystem(rt, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return meteredNamesys{ns}, nil
 	}
 }
 
@@ -0,0 +1,78 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-namesys"
+	"github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ipnsPublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ipfs_ipns_publish_duration_seconds",
+		Help:    "Time taken to publish IPNS records, by result.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"result"})
+	ipnsResolveDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ipfs_ipns_resolve_duration_seconds",
+		Help:    "Time taken to resolve names, by result.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"result"})
+)
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// meteredNamesys records how long publishing and resolving names takes.
+//
+// Resolves served from the namesys cache are not told apart from the ones
+// that hit the network: the cache is internal to go-namesys. They show up in
+// the lowest buckets of the resolve histogram.
+type meteredNamesys struct {
+	namesys.NameSystem
+}
+
+func (ns meteredNamesys) Resolve(ctx context.Context, name string, options ...opts.ResolveOpt) (path.Path, error) {
+	start := time.Now()
+	p, err := ns.NameSystem.Resolve(ctx, name, options...)
+	ipnsResolveDuration.WithLabelValues(resultLabel(err)).Observe(time.Since(start).Seconds())
+	return p, err
+}
+
+func (ns meteredNamesys) ResolveAsync(ctx context.Context, name string, options ...opts.ResolveOpt) <-chan namesys.Result {
+	start := time.Now()
+	in := ns.NameSystem.ResolveAsync(ctx, name, options...)
+	out := make(chan namesys.Result, cap(in))
+	go func() {
+		defer close(out)
+		// Each result supersedes the previous one, so the last one tells
+		// whether the resolve succeeded. No result at all is a failure.
+		var last error = namesys.ErrResolveFailed
+		for res := range in {
+			last = res.Err
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+		ipnsResolveDuration.WithLabelValues(resultLabel(last)).Observe(time.Since(start).Seconds())
+	}()
+	return out
+}
+
+func (ns meteredNamesys) Publish(ctx context.Context, name crypto.PrivKey, value path.Path, options ...opts.PublishOption) error {
+	start := time.Now()
+	err := ns.NameSystem.Publish(ctx, name, value, options...)
+	ipnsPublishDuration.WithLabelValues(resultLabel(err)).Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,76 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-namesys"
+	"github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// stubNamesys resolves "good" names and fails everything else.
+type stubNamesys struct{}
+
+func (stubNamesys) Resolve(_ context.Context, name string, _ ...opts.ResolveOpt) (path.Path, error) {
+	if name == "good" {
+		return path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), nil
+	}
+	return "", namesys.ErrResolveFailed
+}
+
+func (ns stubNamesys) ResolveAsync(ctx context.Context, name string, options ...opts.ResolveOpt) <-chan namesys.Result {
+	out := make(chan namesys.Result, 1)
+	p, err := ns.Resolve(ctx, name, options...)
+	out <- namesys.Result{Path: p, Err: err}
+	close(out)
+	return out
+}
+
+func (stubNamesys) Publish(context.Context, crypto.PrivKey, path.Path, ...opts.PublishOption) error {
+	return errors.New("offline")
+}
+
+func sampleCount(t *testing.T, h *prometheus.HistogramVec, result string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.WithLabelValues(result).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMeteredNamesys(t *testing.T) {
+	ctx := context.Background()
+	ns := meteredNamesys{stubNamesys{}}
+
+	resolved := sampleCount(t, ipnsResolveDuration, "success")
+	failed := sampleCount(t, ipnsResolveDuration, "failure")
+	published := sampleCount(t, ipnsPublishDuration, "failure")
+
+	if _, err := ns.Resolve(ctx, "good"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Resolve(ctx, "bad"); err == nil {
+		t.Fatal("expected resolve to fail")
+	}
+	for range ns.ResolveAsync(ctx, "good") {
+	}
+	if err := ns.Publish(ctx, nil, ""); err == nil {
+		t.Fatal("expected publish to fail")
+	}
+
+	if got := sampleCount(t, ipnsResolveDuration, "success") - resolved; got != 2 {
+		t.Fatalf("expected 2 successful resolves, got %d", got)
+	}
+	if got := sampleCount(t, ipnsResolveDuration, "failure") - failed; got != 1 {
+		t.Fatalf("expected 1 failed resolve, got %d", got)
+	}
+	if got := sampleCount(t, ipnsPublishDuration, "failure") - published; got != 1 {
+		t.Fatalf("expected 1 failed publish, got %d", got)
+	}
+}
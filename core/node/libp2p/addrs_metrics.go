@@ -0,0 +1,55 @@
+package libp2p
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"go.uber.org/fx"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var addrChanges = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libp2p_host_addr_changes_total",
+		Help: "changes to the addresses the host advertises, by change (added or removed)",
+	},
+	[]string{"change"},
+)
+
+// AddrsMetrics counts the changes to the host addresses reported on the
+// host event bus, e.g. as NAT mappings or relay reservations come and go.
+func AddrsMetrics(lc fx.Lifecycle, host host.Host) {
+	var sub event.Subscription
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) (err error) {
+			sub, err = host.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+			if err != nil {
+				return err
+			}
+			go recordAddrChanges(sub.Out())
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return sub.Close()
+		},
+	})
+}
+
+// recordAddrChanges updates the counters until the subscription is closed.
+func recordAddrChanges(events <-chan interface{}) {
+	for e := range events {
+		evt := e.(event.EvtLocalAddressesUpdated)
+		if !evt.Diffs {
+			continue
+		}
+		for _, a := range evt.Current {
+			if a.Action == event.Added {
+				addrChanges.WithLabelValues("added").Inc()
+			}
+		}
+		addrChanges.WithLabelValues("removed").Add(float64(len(evt.Removed)))
+	}
+}
@@ -0,0 +1,51 @@
+package libp2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrChanges(t *testing.T) {
+	bus := eventbus.NewBus()
+	emitter, err := bus.Emitter(new(event.EvtLocalAddressesUpdated))
+	require.NoError(t, err)
+	defer emitter.Close()
+	sub, err := bus.Subscribe(new(event.EvtLocalAddressesUpdated))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		recordAddrChanges(sub.Out())
+		close(done)
+	}()
+
+	added := addrChanges.WithLabelValues("added")
+	removed := addrChanges.WithLabelValues("removed")
+	addedBefore, removedBefore := testutil.ToFloat64(added), testutil.ToFloat64(removed)
+
+	// The mapped address replaces the relayed one, the local one stays.
+	local := ma.StringCast("/ip4/192.168.1.2/tcp/4001")
+	mapped := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	relayed := ma.StringCast("/ip4/5.6.7.8/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN/p2p-circuit")
+	require.NoError(t, emitter.Emit(event.EvtLocalAddressesUpdated{
+		Diffs: true,
+		Current: []event.UpdatedAddress{
+			{Address: local, Action: event.Maintained},
+			{Address: mapped, Action: event.Added},
+		},
+		Removed: []event.UpdatedAddress{{Address: relayed, Action: event.Removed}},
+	}))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(removed) == removedBefore+1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, addedBefore+1, testutil.ToFloat64(added))
+
+	require.NoError(t, sub.Close())
+	<-done
+}
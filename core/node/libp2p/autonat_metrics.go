@@ -0,0 +1,44 @@
+package libp2p
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"go.uber.org/fx"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var reachability = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "libp2p_autonat_reachability",
+	Help: "reachability of the node as determined by AutoNAT: 0 unknown, 1 public, 2 private",
+})
+
+// AutoNATMetrics records the reachability reported by AutoNAT on the host
+// event bus.
+func AutoNATMetrics(lc fx.Lifecycle, host host.Host) {
+	var sub event.Subscription
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) (err error) {
+			sub, err = host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+			if err != nil {
+				return err
+			}
+			go recordReachability(sub.Out())
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return sub.Close()
+		},
+	})
+}
+
+// recordReachability updates the gauge until the subscription is closed.
+func recordReachability(events <-chan interface{}) {
+	for e := range events {
+		// network.Reachability uses the encoding of the gauge.
+		reachability.Set(float64(e.(event.EvtLocalReachabilityChanged).Reachability))
+	}
+}
@@ -0,0 +1,38 @@
+package libp2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReachability(t *testing.T) {
+	bus := eventbus.NewBus()
+	emitter, err := bus.Emitter(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+	defer emitter.Close()
+	sub, err := bus.Subscribe(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		recordReachability(sub.Out())
+		close(done)
+	}()
+
+	for _, r := range []network.Reachability{network.ReachabilityPrivate, network.ReachabilityPublic} {
+		require.NoError(t, emitter.Emit(event.EvtLocalReachabilityChanged{Reachability: r}))
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(reachability) == float64(r)
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	// Closing the subscription stops the recording.
+	require.NoError(t, sub.Close())
+	<-done
+}
@@ -0,0 +1,18 @@
+package libp2p
+
+import (
+	dhtmetrics "github.com/libp2p/go-libp2p-kad-dht/metrics"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// dhtInboundQueriesView counts the DHT requests served to other peers by
+// message type. The DHT's own views are also tagged by peer ID, which is far
+// too many series to export.
+var dhtInboundQueriesView = &view.View{
+	Name:        "ipfs_dht_inbound_queries",
+	Description: "Number of DHT requests received from other peers, by message type.",
+	Measure:     dhtmetrics.ReceivedMessages,
+	TagKeys:     []tag.Key{dhtmetrics.KeyMessageType},
+	Aggregation: view.Sum(),
+}
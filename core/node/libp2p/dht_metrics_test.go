@@ -0,0 +1,38 @@
+package libp2p
+
+import (
+	"context"
+	"testing"
+
+	dhtmetrics "github.com/libp2p/go-libp2p-kad-dht/metrics"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestDHTInboundQueries(t *testing.T) {
+	require.NoError(t, view.Register(dhtInboundQueriesView))
+	defer view.Unregister(dhtInboundQueriesView)
+
+	// Record the way the DHT does when it handles a request.
+	served := func(msgType string, n int) {
+		ctx, err := tag.New(context.Background(), tag.Upsert(dhtmetrics.KeyMessageType, msgType))
+		require.NoError(t, err)
+		for i := 0; i < n; i++ {
+			stats.Record(ctx, dhtmetrics.ReceivedMessages.M(1))
+		}
+	}
+	served("FIND_NODE", 3)
+	served("GET_PROVIDERS", 1)
+
+	rows, err := view.RetrieveData(dhtInboundQueriesView.Name)
+	require.NoError(t, err)
+
+	got := make(map[string]float64)
+	for _, row := range rows {
+		require.Len(t, row.Tags, 1)
+		got[row.Tags[0].Value] = row.Data.(*view.SumData).Value
+	}
+	require.Equal(t, map[string]float64{"FIND_NODE": 3, "GET_PROVIDERS": 1}, got)
+}
@@ -80,6 +80,8 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 		out.Host = routedhost.Wrap(out.Host, out.Routing)
 	}
 
+	out.Host = newMeteredHost(out.Host)
+
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
 			return out.Host.Close()
@@ -0,0 +1,108 @@
+package libp2p
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var streamOpenLatency = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "libp2p_network_stream_open_latency_seconds",
+		Help: "time taken to open and negotiate an outbound stream",
+	},
+	[]string{"protocol"},
+)
+
+var dials = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libp2p_swarm_dials_total",
+		Help: "connection attempts made through the host's Connect by result, and by reason for failures",
+	},
+	[]string{"result", "reason"},
+)
+
+// meteredHost wraps a host.Host to record metrics about the operations done
+// through it.
+type meteredHost struct {
+	host.Host
+}
+
+func newMeteredHost(h host.Host) host.Host {
+	return &meteredHost{h}
+}
+
+func (h *meteredHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	start := time.Now()
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	streamOpenLatency.WithLabelValues(string(s.Protocol())).Observe(time.Since(start).Seconds())
+	return s, nil
+}
+
+// Connect counts the dials it makes. Both outcomes are counted here, rather
+// than successes on the network notifications, so the ratio isn't skewed by
+// the connections opened through other paths, e.g. NewStream.
+func (h *meteredHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	// Connecting to a peer we're already connected to doesn't dial.
+	connected := h.Network().Connectedness(pi.ID) == network.Connected
+	err := h.Host.Connect(ctx, pi)
+	if !connected {
+		dialDone(ctx, err)
+	}
+	return err
+}
+
+// dialDone counts a dial by its result. Dials given up by the caller, e.g.
+// when a DHT query has its answer, are not counted as failures.
+func dialDone(ctx context.Context, err error) {
+	switch {
+	case err == nil:
+		dials.WithLabelValues("success", "").Inc()
+	case ctx.Err() != nil, errors.Is(err, context.Canceled):
+	default:
+		dials.WithLabelValues("failure", dialErrorReason(err)).Inc()
+	}
+}
+
+// dialErrorReason classifies a dial error as "timeout", "refused",
+// "no_route" or "other". For swarm dial errors the per-address errors are
+// inspected too, the first one with a known class wins.
+func dialErrorReason(err error) string {
+	errs := []error{err}
+	var de *swarm.DialError
+	if errors.As(err, &de) {
+		for _, te := range de.DialErrors {
+			errs = append(errs, te.Cause)
+		}
+	}
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return "refused"
+		case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH),
+			errors.Is(err, swarm.ErrNoAddresses), errors.Is(err, swarm.ErrNoGoodAddresses):
+			return "no_route"
+		case errors.Is(err, context.DeadlineExceeded), isTimeout(err):
+			return "timeout"
+		}
+	}
+	return "other"
+}
+
+func isTimeout(err error) bool {
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
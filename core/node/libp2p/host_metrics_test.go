@@ -0,0 +1,113 @@
+package libp2p
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+type slowStream struct {
+	network.Stream
+	proto protocol.ID
+}
+
+func (s slowStream) Protocol() protocol.ID { return s.proto }
+
+// slowHost takes delay to negotiate any stream.
+type slowHost struct {
+	host.Host
+	delay time.Duration
+}
+
+func (h slowHost) NewStream(_ context.Context, _ peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	time.Sleep(h.delay)
+	return slowStream{proto: pids[0]}, nil
+}
+
+func TestStreamOpenLatency(t *testing.T) {
+	const proto = protocol.ID("/test/slow/1.0.0")
+	delay := 50 * time.Millisecond
+
+	h := newMeteredHost(slowHost{delay: delay})
+	_, err := h.NewStream(context.Background(), peer.ID("peer"), proto)
+	require.NoError(t, err)
+
+	var m dto.Metric
+	require.NoError(t, streamOpenLatency.WithLabelValues(string(proto)).(prometheus.Histogram).Write(&m))
+	require.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+	require.GreaterOrEqual(t, m.GetHistogram().GetSampleSum(), delay.Seconds())
+}
+
+func TestDialErrorReason(t *testing.T) {
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	for _, tc := range []struct {
+		err    error
+		reason string
+	}{
+		{context.DeadlineExceeded, "timeout"},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "refused"},
+		{&swarm.DialError{Peer: peer.ID("peer"), Cause: swarm.ErrNoAddresses}, "no_route"},
+		{&swarm.DialError{Peer: peer.ID("peer"), DialErrors: []swarm.TransportError{
+			{Address: addr, Cause: os.NewSyscallError("connect", syscall.EHOSTUNREACH)},
+		}}, "no_route"},
+		{errors.New("protocol negotiation failed"), "other"},
+	} {
+		require.Equal(t, tc.reason, dialErrorReason(tc.err), tc.err.Error())
+	}
+}
+
+// dialHost fails every dial with err, or succeeds if it is nil.
+type dialHost struct {
+	host.Host
+	err error
+}
+
+func (h dialHost) Network() network.Network { return dialNetwork{} }
+
+func (h dialHost) Connect(context.Context, peer.AddrInfo) error { return h.err }
+
+type dialNetwork struct {
+	network.Network
+}
+
+func (dialNetwork) Connectedness(peer.ID) network.Connectedness { return network.NotConnected }
+
+func TestDials(t *testing.T) {
+	pi := peer.AddrInfo{ID: peer.ID("peer")}
+	successes := dials.WithLabelValues("success", "")
+	failures := dials.WithLabelValues("failure", "timeout")
+	others := dials.WithLabelValues("failure", "other")
+	beforeSuccesses := testutil.ToFloat64(successes)
+	beforeFailures := testutil.ToFloat64(failures)
+	beforeOthers := testutil.ToFloat64(others)
+
+	require.NoError(t, newMeteredHost(dialHost{}).Connect(context.Background(), pi))
+	require.Equal(t, beforeSuccesses+1, testutil.ToFloat64(successes))
+
+	h := newMeteredHost(dialHost{err: context.DeadlineExceeded})
+	require.Error(t, h.Connect(context.Background(), pi))
+	require.Equal(t, beforeFailures+1, testutil.ToFloat64(failures))
+
+	// Dials abandoned by the caller are not failures.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, newMeteredHost(dialHost{err: errors.New("dial backoff")}).Connect(ctx, pi))
+	require.Error(t, newMeteredHost(dialHost{err: context.Canceled}).Connect(context.Background(), pi))
+	require.Equal(t, beforeFailures+1, testutil.ToFloat64(failures))
+	require.Equal(t, beforeOthers, testutil.ToFloat64(others))
+}
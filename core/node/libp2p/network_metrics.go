@@ -0,0 +1,89 @@
+package libp2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"go.uber.org/fx"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var relayFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "libp2p_swarm_relay_fallbacks_total",
+	Help: "outbound connections established through a relay to peers with a known public direct address",
+})
+
+var timeToFirstPeer = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "libp2p_network_time_to_first_peer_seconds",
+	Help: "time from node start until the first peer connection was established, 0 until then",
+})
+
+var disconnects = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "libp2p_swarm_disconnects_total",
+	Help: "connections closed, in either direction",
+})
+
+// NetworkMetrics installs a notifiee on the host network which records
+// metrics about the connections it observes.
+func NetworkMetrics(lc fx.Lifecycle, host host.Host) {
+	nm := &networkMetrics{ps: host.Peerstore()}
+	notifiee := &network.NotifyBundle{
+		ConnectedF:    nm.connected,
+		DisconnectedF: nm.disconnected,
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			nm.start = time.Now()
+			host.Network().Notify(notifiee)
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			host.Network().StopNotify(notifiee)
+			return nil
+		},
+	})
+}
+
+type networkMetrics struct {
+	ps peerstore.Peerstore
+
+	start     time.Time
+	firstPeer sync.Once
+}
+
+func (nm *networkMetrics) connected(_ network.Network, c network.Conn) {
+	nm.firstPeer.Do(func() {
+		timeToFirstPeer.Set(time.Since(nm.start).Seconds())
+	})
+
+	if c.Stat().Direction == network.DirOutbound && isRelayAddr(c.RemoteMultiaddr()) {
+		// We dialed a relayed address although the peer advertises a
+		// public direct address: the direct dials didn't get us through.
+		// Private addresses don't count, peers behind a NAT learn them
+		// through identify but they're usually unreachable from outside.
+		for _, addr := range nm.ps.Addrs(c.RemotePeer()) {
+			if !isRelayAddr(addr) && manet.IsPublicAddr(addr) {
+				relayFallbacks.Inc()
+				break
+			}
+		}
+	}
+}
+
+func (nm *networkMetrics) disconnected(_ network.Network, _ network.Conn) {
+	disconnects.Inc()
+}
+
+func isRelayAddr(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
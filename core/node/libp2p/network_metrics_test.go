@@ -0,0 +1,88 @@
+package libp2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	network.Conn
+	remote peer.ID
+	addr   ma.Multiaddr
+	stat   network.ConnStats
+}
+
+func (c fakeConn) RemotePeer() peer.ID           { return c.remote }
+func (c fakeConn) RemoteMultiaddr() ma.Multiaddr { return c.addr }
+func (c fakeConn) Stat() network.ConnStats       { return c.stat }
+
+func TestRelayFallbacks(t *testing.T) {
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	nm := &networkMetrics{ps: ps}
+
+	direct := peer.ID("direct")
+	unknown := peer.ID("unknown")
+	natted := peer.ID("natted")
+	ps.AddAddr(direct, ma.StringCast("/ip4/1.2.3.4/tcp/4001"), peerstore.PermanentAddrTTL)
+	ps.AddAddr(natted, ma.StringCast("/ip4/192.168.1.2/tcp/4001"), peerstore.PermanentAddrTTL)
+
+	relayed := ma.StringCast("/ip4/5.6.7.8/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN/p2p-circuit")
+	outbound := network.ConnStats{Stats: network.Stats{Direction: network.DirOutbound}}
+
+	before := testutil.ToFloat64(relayFallbacks)
+
+	// A relayed connection to a peer we know no direct address for is not a fallback.
+	nm.connected(nil, fakeConn{remote: unknown, addr: relayed, stat: outbound})
+	require.Equal(t, before, testutil.ToFloat64(relayFallbacks))
+
+	// Neither is one to a peer we only know private addresses for.
+	nm.connected(nil, fakeConn{remote: natted, addr: relayed, stat: outbound})
+	require.Equal(t, before, testutil.ToFloat64(relayFallbacks))
+
+	// The direct dials to this peer failed and we went through the relay.
+	nm.connected(nil, fakeConn{remote: direct, addr: relayed, stat: outbound})
+	require.Equal(t, before+1, testutil.ToFloat64(relayFallbacks))
+}
+
+func TestTimeToFirstPeer(t *testing.T) {
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	nm := &networkMetrics{ps: ps, start: time.Now().Add(-time.Second)}
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	nm.connected(nil, fakeConn{remote: peer.ID("first"), addr: addr})
+	first := testutil.ToFloat64(timeToFirstPeer)
+	require.GreaterOrEqual(t, first, 1.0)
+
+	// Only the first connection is recorded.
+	nm.connected(nil, fakeConn{remote: peer.ID("second"), addr: addr})
+	require.Equal(t, first, testutil.ToFloat64(timeToFirstPeer))
+}
+
+func TestDisconnects(t *testing.T) {
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	nm := &networkMetrics{ps: ps}
+
+	beforeDisconnects := testutil.ToFloat64(disconnects)
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	outbound := fakeConn{remote: peer.ID("out"), addr: addr, stat: network.ConnStats{Stats: network.Stats{Direction: network.DirOutbound}}}
+	inbound := fakeConn{remote: peer.ID("in"), addr: addr, stat: network.ConnStats{Stats: network.Stats{Direction: network.DirInbound}}}
+
+	nm.disconnected(nil, outbound)
+	nm.disconnected(nil, inbound)
+	require.Equal(t, beforeDisconnects+2, testutil.ToFloat64(disconnects))
+}
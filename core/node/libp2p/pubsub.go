@@ -11,7 +11,11 @@ import (
 
 func FloodSub(pubsubOptions ...pubsub.Option) interface{} {
 	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, disc discovery.Discovery) (service *pubsub.PubSub, err error) {
-		return pubsub.NewFloodSub(helpers.LifecycleCtx(mctx, lc), host, append(pubsubOptions, pubsub.WithDiscovery(disc))...)
+		return pubsub.NewFloodSub(helpers.LifecycleCtx(mctx, lc), host, append(
+			pubsubOptions,
+			pubsub.WithDiscovery(disc),
+			pubsub.WithEventTracer(newPubsubMetrics(host.ID())))...,
+		)
 	}
 }
 
@@ -20,7 +24,8 @@ func GossipSub(pubsubOptions ...pubsub.Option) interface{} {
 		return pubsub.NewGossipSub(helpers.LifecycleCtx(mctx, lc), host, append(
 			pubsubOptions,
 			pubsub.WithDiscovery(disc),
-			pubsub.WithFloodPublish(true))...,
+			pubsub.WithFloodPublish(true),
+			pubsub.WithEventTracer(newPubsubMetrics(host.ID())))...,
 		)
 	}
 }
@@ -0,0 +1,90 @@
+package libp2p
+
+import (
+	"sync"
+	"unicode/utf8"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mbase "github.com/multiformats/go-multibase"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var pubsubMessages = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libp2p_pubsub_messages_total",
+		Help: "pubsub messages on the topics we are subscribed to, by topic and direction (published or received)",
+	},
+	[]string{"topic", "direction"},
+)
+
+// PubsubTopicLabel returns the label value a topic is reported under. Topics
+// are arbitrary bytes, but label values must be valid UTF-8 or collecting
+// them panics: other topics are reported base64url multibase encoded, like
+// the RPC API encodes them.
+func PubsubTopicLabel(topic string) string {
+	if utf8.ValidString(topic) {
+		return topic
+	}
+	label, _ := mbase.Encode(mbase.Base64url, []byte(topic))
+	return label
+}
+
+// pubsubMetrics is a pubsub event tracer counting the messages published
+// and received on joined topics. Raw tracers are not told about the
+// messages we publish, hence the event tracer. The series of a topic are
+// dropped when we leave it, so that only the topics we are currently
+// subscribed to are tracked.
+type pubsubMetrics struct {
+	self peer.ID
+
+	mu     sync.Mutex
+	joined map[string]struct{}
+}
+
+var _ pubsub.EventTracer = (*pubsubMetrics)(nil)
+
+func newPubsubMetrics(self peer.ID) *pubsubMetrics {
+	return &pubsubMetrics{self: self, joined: make(map[string]struct{})}
+}
+
+func (pm *pubsubMetrics) Trace(evt *pb.TraceEvent) {
+	switch evt.GetType() {
+	case pb.TraceEvent_JOIN:
+		pm.join(evt.GetJoin().GetTopic())
+	case pb.TraceEvent_LEAVE:
+		pm.leave(evt.GetLeave().GetTopic())
+	case pb.TraceEvent_PUBLISH_MESSAGE:
+		pm.message(evt.GetPublishMessage().GetTopic(), "published")
+	case pb.TraceEvent_DELIVER_MESSAGE:
+		// Our own messages are delivered to our subscriptions too.
+		if peer.ID(evt.GetDeliverMessage().GetReceivedFrom()) != pm.self {
+			pm.message(evt.GetDeliverMessage().GetTopic(), "received")
+		}
+	}
+}
+
+func (pm *pubsubMetrics) join(topic string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.joined[topic] = struct{}{}
+}
+
+func (pm *pubsubMetrics) leave(topic string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	delete(pm.joined, topic)
+	pubsubMessages.DeleteLabelValues(PubsubTopicLabel(topic), "published")
+	pubsubMessages.DeleteLabelValues(PubsubTopicLabel(topic), "received")
+}
+
+func (pm *pubsubMetrics) message(topic, direction string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if _, ok := pm.joined[topic]; ok {
+		pubsubMessages.WithLabelValues(PubsubTopicLabel(topic), direction).Inc()
+	}
+}
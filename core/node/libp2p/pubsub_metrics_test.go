@@ -0,0 +1,69 @@
+package libp2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubsubMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshLinked(2)
+	require.NoError(t, err)
+	defer mn.Close()
+
+	const topic = "test-pubsub-messages"
+	hosts := mn.Hosts()
+	subs := make([]*pubsub.Subscription, len(hosts))
+	psubs := make([]*pubsub.PubSub, len(hosts))
+	for i, h := range hosts {
+		psubs[i], err = pubsub.NewFloodSub(ctx, h, pubsub.WithEventTracer(newPubsubMetrics(h.ID())))
+		require.NoError(t, err)
+		subs[i], err = psubs[i].Subscribe(topic)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mn.ConnectAllButSelf())
+	require.Eventually(t, func() bool { return len(psubs[0].ListPeers(topic)) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Both nodes share the counters: the publisher counts one published
+	// message and the other node one received message.
+	published := pubsubMessages.WithLabelValues(topic, "published")
+	received := pubsubMessages.WithLabelValues(topic, "received")
+	require.NoError(t, psubs[0].Publish(topic, []byte("hello")))
+	for _, sub := range subs {
+		_, err := sub.Next(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1.0, testutil.ToFloat64(published))
+	require.Equal(t, 1.0, testutil.ToFloat64(received))
+
+	// Leaving the topic drops its series.
+	subs[0].Cancel()
+	subs[1].Cancel()
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCount(pubsubMessages) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPubsubTopicLabel(t *testing.T) {
+	require.Equal(t, "test-topic", PubsubTopicLabel("test-topic"))
+
+	// Topics which aren't valid UTF-8 would make the counter panic.
+	topic := "test-\xff-topic"
+	label := PubsubTopicLabel(topic)
+	require.Equal(t, "udGVzdC3_LXRvcGlj", label)
+
+	pm := newPubsubMetrics("self")
+	pm.join(topic)
+	pm.message(topic, "published")
+	require.Equal(t, 1.0, testutil.ToFloat64(pubsubMessages.WithLabelValues(label, "published")))
+	pm.leave(topic)
+	require.Equal(t, 0, testutil.CollectAndCount(pubsubMessages))
+}
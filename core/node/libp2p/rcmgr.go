@@ -84,7 +84,11 @@ func ResourceManager(cfg config.SwarmConfig) interface{} {
 				return nil, opts, err
 			}
 
-			ropts := []rcmgr.Option{rcmgr.WithMetrics(createRcmgrMetrics()), rcmgr.WithTraceReporter(str)}
+			ropts := []rcmgr.Option{
+				rcmgr.WithMetrics(createRcmgrMetrics()),
+				rcmgr.WithTraceReporter(str),
+				rcmgr.WithTraceReporter(createPerPeerCapReporter()),
+			}
 
 			if len(cfg.ResourceMgr.Allowlist) > 0 {
 				var mas []multiaddr.Multiaddr
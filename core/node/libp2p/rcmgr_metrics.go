@@ -3,6 +3,7 @@ package libp2p
 import (
 	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -249,3 +250,29 @@ func (r rcmgrMetrics) AllowMemory(_ int) {
 func (r rcmgrMetrics) BlockMemory(_ int) {
 	r.memoryBlocked.Inc()
 }
+
+func createPerPeerCapReporter() rcmgr.TraceReporter {
+	hits := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "libp2p_network_per_peer_cap_hits_total",
+		Help: "connections refused because the peer reached its per-peer connection limit",
+	})
+	mustRegister(hits)
+
+	return perPeerCapReporter{hits}
+}
+
+// Failsafe to ensure interface from go-libp2p-resource-manager is implemented
+var _ rcmgr.TraceReporter = perPeerCapReporter{}
+
+// perPeerCapReporter counts the connections the resource manager refuses
+// because the peer scope they were being attached to was already at its
+// connection limit.
+type perPeerCapReporter struct {
+	hits prometheus.Counter
+}
+
+func (r perPeerCapReporter) ConsumeEvent(evt rcmgr.TraceEvt) {
+	if evt.Type == rcmgr.TraceBlockAddConnEvt && strings.HasPrefix(evt.Name, "peer:") {
+		r.hits.Inc()
+	}
+}
@@ -0,0 +1,40 @@
+package libp2p
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerPeerCapReporter(t *testing.T) {
+	limits := rcmgr.DefaultLimits.AutoScale()
+	limits.PeerDefault.Conns = 1
+	limits.PeerDefault.ConnsInbound = 1
+	limits.PeerDefault.ConnsOutbound = 1
+
+	hits := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_per_peer_cap_hits_total"})
+	mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits), rcmgr.WithTraceReporter(perPeerCapReporter{hits}))
+	require.NoError(t, err)
+	defer mgr.Close()
+
+	p := peer.ID("peer")
+	addr := multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001")
+
+	first, err := mgr.OpenConnection(network.DirOutbound, true, addr)
+	require.NoError(t, err)
+	defer first.Done()
+	require.NoError(t, first.SetPeer(p))
+	require.Equal(t, 0.0, testutil.ToFloat64(hits))
+
+	second, err := mgr.OpenConnection(network.DirOutbound, true, addr)
+	require.NoError(t, err)
+	defer second.Done()
+	require.Error(t, second.SetPeer(p))
+	require.Equal(t, 1.0, testutil.ToFloat64(hits))
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/routing"
+	"go.opencensus.io/stats/view"
 	"go.uber.org/fx"
 
 	config "github.com/ipfs/kubo/config"
@@ -91,6 +92,12 @@ func BaseRouting(experimentalDHTClient bool) interface{} {
 			}
 		}
 
+		if dr != nil {
+			if err := view.Register(dhtInboundQueriesView); err != nil {
+				return out, fmt.Errorf("registering dht metrics views: %w", err)
+			}
+		}
+
 		if dr != nil && experimentalDHTClient {
 			cfg, err := in.Repo.Config()
 			if err != nil {
@@ -95,6 +95,7 @@ func OnlineProviders(useStrategicProviding bool, useBatchedProviding bool, repro
 
 	return fx.Options(
 		SimpleProviders(reprovideStrategy, reprovideInterval),
+		fx.Decorate(meteredKeyProvider(reprovideInterval)),
 		maybeProvide(SimpleProviderSys(true), !useBatchedProviding),
 		maybeProvide(BatchedProviderSys(true, reprovideInterval), useBatchedProviding),
 	)
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reprovideDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_provider_reprovide_duration_seconds",
+		Help: "Time taken by the last completed reprovide to go through all the keys.",
+	})
+	reprovideKeys = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_provider_reprovide_keys",
+		Help: "Number of keys announced by the last completed reprovide.",
+	})
+	reprovideNext = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_provider_reprovide_next_timestamp_seconds",
+		Help: "Unix time by which the next reprovide is expected to start, 0 if reproviding is disabled.",
+	})
+)
+
+// initialReprovideDelay is how long both reproviders wait after starting
+// before their first reprovide, when the interval is longer than that.
+const initialReprovideDelay = time.Minute
+
+// firstReprovide returns when a reprovider started at now first reprovides.
+func firstReprovide(now time.Time, interval time.Duration) time.Time {
+	if interval > initialReprovideDelay {
+		return now.Add(initialReprovideDelay)
+	}
+	return now.Add(interval)
+}
+
+// meteredKeyProvider records reprovide metrics around the key provider.
+// Every reprovide, simple or batched, starts by asking it for the keys to
+// announce, and is done with them once the channel it returns is drained.
+//
+// With the simple reprovider keys are announced as they are read, so the
+// duration covers the announcements. The batched one hands the keys over to
+// its batching loop, which announces them afterwards.
+func meteredKeyProvider(interval time.Duration) interface{} {
+	return func(keyProvider simple.KeyChanFunc) simple.KeyChanFunc {
+		if interval <= 0 {
+			return keyProvider
+		}
+		reprovideNext.Set(float64(firstReprovide(time.Now(), interval).Unix()))
+
+		return func(ctx context.Context) (<-chan cid.Cid, error) {
+			start := time.Now()
+			reprovideNext.Set(float64(start.Add(interval).Unix()))
+
+			keys, err := keyProvider(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			out := make(chan cid.Cid)
+			go func() {
+				defer close(out)
+				var n int
+				for c := range keys {
+					select {
+					case out <- c:
+						n++
+					case <-ctx.Done():
+						return
+					}
+				}
+				reprovideDuration.Set(time.Since(start).Seconds())
+				reprovideKeys.Set(float64(n))
+			}()
+			return out, nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReprovideMetrics(t *testing.T) {
+	keys := []cid.Cid{
+		cid.NewCidV1(cid.Raw, []byte("a")),
+		cid.NewCidV1(cid.Raw, []byte("b")),
+		cid.NewCidV1(cid.Raw, []byte("c")),
+	}
+	var keyProvider simple.KeyChanFunc = func(context.Context) (<-chan cid.Cid, error) {
+		ch := make(chan cid.Cid, len(keys))
+		for _, c := range keys {
+			ch <- c
+		}
+		close(ch)
+		return ch, nil
+	}
+
+	interval := time.Hour
+	metered := meteredKeyProvider(interval).(func(simple.KeyChanFunc) simple.KeyChanFunc)(keyProvider)
+	// The first reprovide comes after the initial delay, not an interval.
+	first := float64(time.Now().Add(initialReprovideDelay).Unix())
+	if next := testutil.ToFloat64(reprovideNext); next < first-1 || next > first+1 {
+		t.Fatalf("first reprovide not scheduled after the initial delay, got %v", next)
+	}
+
+	ch, err := metered(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for range ch {
+		n++
+	}
+	if n != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), n)
+	}
+	if got := testutil.ToFloat64(reprovideKeys); got != float64(len(keys)) {
+		t.Fatalf("expected %d reprovided keys, got %v", len(keys), got)
+	}
+}
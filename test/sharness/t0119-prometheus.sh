@@ -57,4 +57,32 @@ test_expect_success "make sure initial metrics added by setting ResourceMgr.Enab
   diff -u ../t0116-prometheus-data/prometheus_metrics_added_by_enabling_rcmgr rcmgr_metrics
 '
 
+test_launch_ipfs_daemon --routing=dhtclient
+
+test_expect_success "collect metrics" '
+  curl "$API_ADDR/debug/metrics/prometheus" > raw_metrics
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "routing mode is reported" '
+  grep -q "^ipfs_routing_mode{mode=\"dhtclient\"} 1$" raw_metrics
+'
+
+test_expect_success "build info includes the commit and build date" '
+  grep -q "^ipfs_info{build_date=\"[^\"]\+\",commit=\"[^\"]\+\",version=\"[^\"]\+\"} 1$" raw_metrics
+'
+
+test_launch_ipfs_daemon_without_network --routing=dhtclient
+
+test_expect_success "collect metrics" '
+  curl "$API_ADDR/debug/metrics/prometheus" > raw_metrics
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "offline routing mode is reported" '
+  grep -q "^ipfs_routing_mode{mode=\"offline\"} 1$" raw_metrics
+'
+
 test_done
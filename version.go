@@ -10,6 +10,10 @@ import (
 // CurrentCommit is the current git commit, this is set as a ldflag in the Makefile
 var CurrentCommit string
 
+// CurrentBuildDate is the UTC time of the commit the binary was built from,
+// or SOURCE_DATE_EPOCH when set, this is set as a ldflag in the Makefile
+var CurrentBuildDate string
+
 // CurrentVersionNumber is the current application's version literal
 const CurrentVersionNumber = "0.19.0-dev"
 